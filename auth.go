@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerFlags collects repeatable -header k=v flags.
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlags) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+		return fmt.Errorf("header %q is not in k=v form", value)
+	}
+	h[strings.ToLower(strings.TrimSpace(kv[0]))] = kv[1]
+	return nil
+}
+
+// tokenSource yields the bearer token for a call. The first non-empty source
+// wins: the literal token, then the environment variable, then the file. The
+// file is re-read whenever its modification time changes so that rotated
+// tokens are picked up without a restart.
+type tokenSource struct {
+	token string
+	env   string
+	file  string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	cached  string
+}
+
+func (s *tokenSource) Token() (string, error) {
+	if s.token != "" {
+		return s.token, nil
+	}
+	if s.env != "" {
+		if token := os.Getenv(s.env); token != "" {
+			return token, nil
+		}
+	}
+	if s.file == "" {
+		return "", nil
+	}
+
+	info, err := os.Stat(s.file)
+	if err != nil {
+		return "", err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !info.ModTime().Equal(s.modTime) {
+		b, err := ioutil.ReadFile(s.file)
+		if err != nil {
+			return "", err
+		}
+		s.cached = strings.TrimSpace(string(b))
+		s.modTime = info.ModTime()
+	}
+	return s.cached, nil
+}
+
+// callCredentials attaches the custom headers and the bearer token to every
+// RPC. It implements credentials.PerRPCCredentials.
+type callCredentials struct {
+	headers map[string]string
+	tokens  *tokenSource
+}
+
+func (c *callCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := make(map[string]string, len(c.headers)+1)
+	for k, v := range c.headers {
+		md[k] = v
+	}
+
+	if c.tokens != nil {
+		token, err := c.tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			md["authorization"] = "Bearer " + token
+		}
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity is false because meshes commonly terminate TLS in
+// a sidecar and the client talks plaintext to it.
+func (c *callCredentials) RequireTransportSecurity() bool {
+	return false
+}
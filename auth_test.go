@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderFlags(t *testing.T) {
+	h := headerFlags{}
+	assert.NoError(t, h.Set("Host=model.example.com"))
+	assert.NoError(t, h.Set("x-tenant=a=b"))
+	assert.Error(t, h.Set("novalue"))
+	assert.Error(t, h.Set("=v"))
+
+	assert.Equal(t, headerFlags{"host": "model.example.com", "x-tenant": "a=b"}, h)
+}
+
+func TestCallCredentialsTokenFileRotation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(file, []byte("first\n"), 0600))
+
+	creds := &callCredentials{
+		headers: map[string]string{"x-tenant": "a"},
+		tokens:  &tokenSource{file: file},
+	}
+
+	md, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"x-tenant": "a", "authorization": "Bearer first"}, md)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("second"), 0600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(file, later, later))
+
+	md, err = creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second", md["authorization"])
+}
+
+func TestTokenSourcePrecedence(t *testing.T) {
+	os.Setenv("TEST_INFERENCE_TOKEN", "from-env")
+	defer os.Unsetenv("TEST_INFERENCE_TOKEN")
+
+	token, err := (&tokenSource{token: "from-flag", env: "TEST_INFERENCE_TOKEN"}).Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "from-flag", token)
+
+	token, err = (&tokenSource{env: "TEST_INFERENCE_TOKEN", file: "missing"}).Token()
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", token)
+
+	_, err = (&tokenSource{file: filepath.Join(t.TempDir(), "missing")}).Token()
+	assert.Error(t, err)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/sirupsen/logrus"
+)
+
+type endpoint struct {
+	addr        string
+	outstanding int64
+	ejected     bool
+}
+
+// balancer spreads requests over several model replicas, always picking the
+// endpoint with the fewest outstanding requests. Endpoints failing
+// ServerReady are ejected until a later check succeeds again.
+type balancer struct {
+	client *KFServingGrpcClient
+
+	// resolve, when set, is called on every health check to pick up
+	// replicas added to or removed from DNS.
+	resolve func() ([]string, error)
+
+	mutex     sync.Mutex
+	endpoints []*endpoint
+	next      int
+}
+
+// resolveEndpoints turns a comma-separated host list into endpoint addresses.
+// A hostname resolving to several A records is expanded into one endpoint per
+// address; otherwise the entry is kept as given. authorities maps every
+// expanded address to the entry it came from. lookup is net.LookupHost
+// outside of tests.
+func resolveEndpoints(hosts string, lookup func(string) ([]string, error)) (addrs []string, authorities map[string]string, err error) {
+	authorities = make(map[string]string)
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		name, port, err := net.SplitHostPort(h)
+		if err != nil || net.ParseIP(name) != nil {
+			addrs = append(addrs, h)
+			continue
+		}
+
+		ips, err := lookup(name)
+		if err != nil || len(ips) < 2 {
+			addrs = append(addrs, h)
+			continue
+		}
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip, port)
+			addrs = append(addrs, addr)
+			authorities[addr] = h
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, nil, fmt.Errorf("no endpoint in host %q", hosts)
+	}
+	return addrs, authorities, nil
+}
+
+func newBalancer(client *KFServingGrpcClient, addrs []string) *balancer {
+	b := &balancer{client: client}
+	for _, addr := range addrs {
+		b.endpoints = append(b.endpoints, &endpoint{addr: addr})
+	}
+	return b
+}
+
+func (b *balancer) acquire() *endpoint {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var best *endpoint
+	for _, onlyHealthy := range []bool{true, false} {
+		for i := range b.endpoints {
+			e := b.endpoints[(b.next+i)%len(b.endpoints)]
+			if onlyHealthy && e.ejected {
+				continue
+			}
+			if best == nil || e.outstanding < best.outstanding {
+				best = e
+			}
+		}
+		if best != nil {
+			break
+		}
+	}
+	b.next = (b.next + 1) % len(b.endpoints)
+
+	best.outstanding++
+	return best
+}
+
+func (b *balancer) release(e *endpoint) {
+	b.mutex.Lock()
+	e.outstanding--
+	b.mutex.Unlock()
+}
+
+func (b *balancer) Inference(ctx context.Context, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	e := b.acquire()
+	defer b.release(e)
+
+	loggerFrom(ctx).WithField("host", e.addr).Debug("send ModelInfer")
+	res, err := b.client.Inference(ctx, e.addr, r)
+	if err != nil {
+		loggerFrom(ctx).WithField("host", e.addr).WithError(err).Warn("ModelInfer failed")
+	}
+	return res, err
+}
+
+// checkHealth probes every endpoint with ServerReady, ejecting the ones that
+// fail and re-adding the ones that recovered.
+func (b *balancer) checkHealth(ctx context.Context, timeout time.Duration) {
+	b.mutex.Lock()
+	endpoints := append([]*endpoint(nil), b.endpoints...)
+	b.mutex.Unlock()
+
+	for _, e := range endpoints {
+		cctx, cancel := context.WithTimeout(ctx, timeout)
+		ready, err := b.client.ServerReady(cctx, e.addr)
+		cancel()
+
+		b.mutex.Lock()
+		switch {
+		case (err != nil || !ready) && !e.ejected:
+			logger.WithFields(logrus.Fields{"host": e.addr, "ready": ready}).WithError(err).Warn("eject endpoint")
+			e.ejected = true
+		case err == nil && ready && e.ejected:
+			logger.WithField("host", e.addr).Info("re-add endpoint")
+			e.ejected = false
+		}
+		b.mutex.Unlock()
+	}
+}
+
+// refresh re-resolves the endpoints, keeping the state of the ones still
+// listed. The current endpoints are kept when resolution fails.
+func (b *balancer) refresh() {
+	if b.resolve == nil {
+		return
+	}
+	addrs, err := b.resolve()
+	if err != nil {
+		logger.WithError(err).Warn("cannot re-resolve endpoints")
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	current := make(map[string]*endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		current[e.addr] = e
+	}
+	endpoints := make([]*endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		e, ok := current[addr]
+		if !ok {
+			logger.WithField("host", addr).Info("add endpoint")
+			e = &endpoint{addr: addr}
+		}
+		delete(current, addr)
+		endpoints = append(endpoints, e)
+	}
+	for addr := range current {
+		logger.WithField("host", addr).Info("remove endpoint")
+	}
+	b.endpoints = endpoints
+	b.next %= len(endpoints)
+}
+
+// watchHealth re-resolves and probes the endpoints every interval until ctx
+// is done. A single endpoint is not probed, as there is nothing to fail over
+// to.
+func (b *balancer) watchHealth(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || (b.resolve == nil && len(b.endpoints) < 2) {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.refresh()
+			b.mutex.Lock()
+			several := len(b.endpoints) > 1
+			b.mutex.Unlock()
+			if several {
+				b.checkHealth(ctx, interval)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
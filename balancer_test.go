@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLookup resolves the names in records and fails for any other.
+func fakeLookup(records map[string][]string) func(string) ([]string, error) {
+	return func(name string) ([]string, error) {
+		if ips, ok := records[name]; ok {
+			return ips, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	lookup := fakeLookup(map[string][]string{
+		"model.svc":  {"10.0.1.1", "10.0.1.2"},
+		"single.svc": {"10.0.2.1"},
+		"ipv6.svc":   {"10.0.3.1", "fd00::1"},
+	})
+
+	addrs, authorities, err := resolveEndpoints("10.0.0.1:9000, 10.0.0.2:9000,,model.svc:9000,single.svc:9000,unknown.svc:9000,ipv6.svc:80", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"10.0.0.1:9000", "10.0.0.2:9000",
+		"10.0.1.1:9000", "10.0.1.2:9000",
+		"single.svc:9000",
+		"unknown.svc:9000",
+		"10.0.3.1:80", "[fd00::1]:80",
+	}, addrs)
+	assert.Equal(t, map[string]string{
+		"10.0.1.1:9000": "model.svc:9000", "10.0.1.2:9000": "model.svc:9000",
+		"10.0.3.1:80": "ipv6.svc:80", "[fd00::1]:80": "ipv6.svc:80",
+	}, authorities)
+
+	_, _, err = resolveEndpoints(" , ", lookup)
+	assert.Error(t, err)
+}
+
+func TestBalancerRefresh(t *testing.T) {
+	records := map[string][]string{"model.svc": {"10.0.0.1", "10.0.0.2"}}
+	b := newBalancer(nil, []string{"10.0.0.1:9000", "10.0.0.2:9000"})
+	b.resolve = func() ([]string, error) {
+		addrs, _, err := resolveEndpoints("model.svc:9000", fakeLookup(records))
+		return addrs, err
+	}
+
+	kept := b.endpoints[1]
+	kept.ejected = true
+	kept.outstanding = 3
+
+	records["model.svc"] = []string{"10.0.0.2", "10.0.0.3"}
+	b.refresh()
+	require.Len(t, b.endpoints, 2)
+	assert.Same(t, kept, b.endpoints[0], "keeps the state of endpoints still listed")
+	assert.Equal(t, "10.0.0.3:9000", b.endpoints[1].addr)
+
+	b.resolve = func() ([]string, error) { return nil, errors.New("resolver down") }
+	b.refresh()
+	assert.Len(t, b.endpoints, 2, "keeps the endpoints when resolution fails")
+}
+
+func TestBalancerLeastOutstanding(t *testing.T) {
+	b := newBalancer(nil, []string{"a", "b", "c"})
+
+	first := b.acquire()
+	second := b.acquire()
+	third := b.acquire()
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, []string{first.addr, second.addr, third.addr})
+
+	b.release(second)
+	assert.Equal(t, second, b.acquire())
+
+	b.endpoints[0].ejected = true
+	b.endpoints[1].ejected = true
+	b.endpoints[2].ejected = true
+	assert.NotNil(t, b.acquire(), "falls back to ejected endpoints when none is healthy")
+
+	b.endpoints[1].ejected = false
+	b.endpoints[1].outstanding = 10
+	assert.Equal(t, "b", b.acquire().addr)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// batchSizer decides how many rows workers put into a chunk. In auto mode it
+// starts from the smallest candidate and tries each larger one for a window
+// of requests, measuring rows/sec and mean latency, and settles on the size
+// with the best throughput once latency breaks the SLO, throughput stops
+// improving or the candidates run out.
+type batchSizer struct {
+	size int64
+
+	mutex         sync.Mutex
+	auto          bool
+	candidates    []int64
+	next          int
+	slo           time.Duration
+	probeRequests int64
+
+	windowStart   time.Time
+	windowRows    int64
+	windowReqs    int64
+	windowLatency time.Duration
+
+	best           int64
+	bestThroughput float64
+}
+
+func newFixedBatchSizer(size int64) *batchSizer {
+	return &batchSizer{size: size}
+}
+
+// newAutoBatchSizer probes powers of two from 1 up to max.
+func newAutoBatchSizer(max int64, slo time.Duration, probeRequests int64) *batchSizer {
+	if max < 1 {
+		max = 1
+	}
+	var candidates []int64
+	for s := int64(1); s < max; s *= 2 {
+		candidates = append(candidates, s)
+	}
+	candidates = append(candidates, max)
+
+	b := &batchSizer{
+		auto:          true,
+		candidates:    candidates,
+		slo:           slo,
+		probeRequests: probeRequests,
+	}
+	b.advance(time.Now())
+	return b
+}
+
+// Max returns the largest size the sizer may pick.
+func (b *batchSizer) Max() int64 {
+	if !b.auto {
+		return atomic.LoadInt64(&b.size)
+	}
+	return b.candidates[len(b.candidates)-1]
+}
+
+func (b *batchSizer) Size() int64 {
+	return atomic.LoadInt64(&b.size)
+}
+
+func (b *batchSizer) advance(now time.Time) {
+	atomic.StoreInt64(&b.size, b.candidates[b.next])
+	b.next++
+	b.windowStart = now
+	b.windowRows, b.windowReqs, b.windowLatency = 0, 0, 0
+}
+
+func (b *batchSizer) settle(reason string) {
+	if b.best == 0 {
+		b.best = b.candidates[0]
+	}
+	atomic.StoreInt64(&b.size, b.best)
+	b.auto = false
+
+	logger.WithFields(logrus.Fields{
+		"batch_size":   b.best,
+		"rows_per_sec": int64(b.bestThroughput),
+		"reason":       reason,
+	}).Info("settle on batch size")
+}
+
+// Observe records a successful ModelInfer call of rows rows that took
+// latency on the wire. Calls of another size than the one probed, such as
+// split or last chunks or chunks cut before the size changed, are ignored.
+func (b *batchSizer) Observe(rows int64, latency time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.auto || rows != b.Size() {
+		return
+	}
+
+	b.windowRows += rows
+	b.windowReqs++
+	b.windowLatency += latency
+	if b.windowReqs < b.probeRequests {
+		return
+	}
+
+	now := time.Now()
+	size := b.Size()
+	throughput := float64(b.windowRows) / now.Sub(b.windowStart).Seconds()
+	mean := b.windowLatency / time.Duration(b.windowReqs)
+
+	logger.WithFields(logrus.Fields{
+		"batch_size":   size,
+		"rows_per_sec": int64(throughput),
+		"latency":      mean.Round(time.Millisecond).String(),
+	}).Info("probe batch size")
+
+	switch {
+	case b.slo > 0 && mean > b.slo:
+		b.settle("latency above SLO")
+	case throughput < b.bestThroughput*0.95:
+		b.settle("throughput stopped improving")
+	default:
+		if throughput > b.bestThroughput {
+			b.best, b.bestThroughput = size, throughput
+		}
+		if b.next == len(b.candidates) {
+			b.settle("largest batch size reached")
+			return
+		}
+		b.advance(now)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// observe completes the current probe window as if it had taken one second.
+func observe(b *batchSizer, latency time.Duration) {
+	b.windowStart = time.Now().Add(-time.Second)
+	b.Observe(b.Size(), latency)
+}
+
+func TestAutoBatchSizerSLO(t *testing.T) {
+	b := newAutoBatchSizer(12, 50*time.Millisecond, 1)
+	assert.Equal(t, []int64{1, 2, 4, 8, 12}, b.candidates)
+
+	for _, size := range []int64{1, 2, 4} {
+		assert.Equal(t, size, b.Size())
+		observe(b, 10*time.Millisecond)
+	}
+	assert.Equal(t, int64(8), b.Size())
+	observe(b, 80*time.Millisecond)
+
+	assert.Equal(t, int64(4), b.Size(), "the largest size within the SLO wins")
+	observe(b, 80*time.Millisecond)
+	assert.Equal(t, int64(4), b.Size(), "stays settled")
+}
+
+func TestAutoBatchSizerMax(t *testing.T) {
+	b := newAutoBatchSizer(4, 0, 1)
+	for i := 0; i < 3; i++ {
+		observe(b, time.Second)
+	}
+	assert.Equal(t, int64(4), b.Size())
+	assert.False(t, b.auto)
+
+	assert.Equal(t, int64(100), newFixedBatchSizer(100).Size())
+}
+
+func TestAutoBatchSizerIgnoresOtherSizes(t *testing.T) {
+	b := newAutoBatchSizer(8, 50*time.Millisecond, 1)
+	b.Observe(1, 10*time.Millisecond)
+	assert.Equal(t, int64(2), b.Size())
+
+	b.Observe(1, time.Second)
+	assert.Equal(t, int64(2), b.Size(), "a late chunk of the previous size does not count")
+	assert.True(t, b.auto)
+	assert.Equal(t, int64(8), b.Max())
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kfserving-inference-client/mapping"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	var opts benchOptions
+	commands = append(commands, &command{
+		name:    "bench",
+		summary: "Load test the model at fixed QPS or fixed concurrency and print latency percentiles and throughput per batch size",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&opts.input, "i", "", "Sample rows from this input file instead of generating random ones")
+			fs.IntVar(&opts.sampleRows, "sample-rows", 10000, "How many rows of -i to load and cycle through")
+			fs.StringVar(&mappingPath, "mapping_path", ".", "The feature mapping csv file path")
+			fs.IntVar(&opts.features, "features", 0, "Number of features of generated rows, taken from ModelMetadata when 0")
+			fs.DurationVar(&opts.duration, "duration", 30*time.Second, "How long to drive load at each batch size")
+			fs.Float64Var(&opts.qps, "qps", 0, "Send this many ModelInfer calls per second, 0 sends as fast as -concurrency allows")
+			fs.IntVar(&opts.concurrency, "concurrency", 8, "Number of ModelInfer calls in flight, the upper bound with -qps")
+			fs.StringVar(&opts.batchSizes, "batch-sizes", "1,8,32,128", "Comma-separated batch sizes to sweep")
+			fs.StringVar(&opts.format, "format", "table", "Output format: table or json")
+		},
+		run: func([]string) error {
+			return runBench(opts)
+		},
+	})
+}
+
+type benchOptions struct {
+	input       string
+	sampleRows  int
+	features    int
+	duration    time.Duration
+	qps         float64
+	concurrency int
+	batchSizes  string
+	format      string
+}
+
+type benchResult struct {
+	BatchSize      int64            `json:"batch_size"`
+	Requests       int              `json:"requests"`
+	RequestsPerSec float64          `json:"requests_per_second"`
+	RowsPerSec     float64          `json:"rows_per_second"`
+	ErrorRate      float64          `json:"error_rate"`
+	FailuresByCode map[string]int64 `json:"failures_by_code"`
+	Latency        latencySummary   `json:"latency"`
+}
+
+func parseBatchSizes(s string) ([]int64, error) {
+	var sizes []int64
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(f), 10, 64)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid batch size %q", f)
+		}
+		sizes = append(sizes, n)
+	}
+	return sizes, nil
+}
+
+// sampleRows loads up to limit rows of an input file, mapped the same way as
+// by the batch processor.
+func sampleRows(path string, limit int) ([][]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	csvr := csv.NewReader(file)
+	head, err := csvr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header of %s: %w", path, err)
+	}
+
+	var rows [][]float64
+	for len(rows) < limit {
+		row, err := csvr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+
+		tensor := make([]float64, 0, len(row)-1)
+		for i, value := range row[1:] {
+			tensor = append(tensor, mapping.GetFeatureMapping(head[i+1], value))
+		}
+		rows = append(rows, tensor)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows in %s", path)
+	}
+	return rows, nil
+}
+
+// syntheticRows generates rows of uniformly random features.
+func syntheticRows(n, features int) [][]float64 {
+	rows := make([][]float64, n)
+	for i := range rows {
+		rows[i] = make([]float64, features)
+		for j := range rows[i] {
+			rows[i][j] = rand.Float64()
+		}
+	}
+	return rows
+}
+
+// modelFeatures reads the number of features from the last dimension of the
+// model's first input.
+func modelFeatures(host string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m, err := kfServingGrpcClient.ModelMetadata(ctx, host, modelName, modelVersion)
+	if err != nil {
+		return 0, fmt.Errorf("ModelMetadata: %w, set -features", err)
+	}
+	if len(m.Inputs) == 0 || len(m.Inputs[0].Shape) == 0 {
+		return 0, fmt.Errorf("model %s has no input shape, set -features", modelName)
+	}
+	n := m.Inputs[0].Shape[len(m.Inputs[0].Shape)-1]
+	if n < 1 {
+		return 0, fmt.Errorf("model %s has a variable number of features, set -features", modelName)
+	}
+	return int(n), nil
+}
+
+func runBench(opts benchOptions) error {
+	sizes, err := parseBatchSizes(opts.batchSizes)
+	if err != nil {
+		return err
+	}
+
+	// The workers are driven through the batch processor's globals, which
+	// are put back once done.
+	defer func(b *balancer, retries int, r *runReport, s *batchSizer, t *throttle, c *concurrencyLimiter) {
+		lb, maxRetries, report, sizer, limiter, concurrency = b, retries, r, s, t, c
+	}(lb, maxRetries, report, sizer, limiter, concurrency)
+
+	addrs, err := connect()
+	if err != nil {
+		return err
+	}
+	defer kfServingGrpcClient.Close()
+	lb = newBalancer(kfServingGrpcClient, addrs)
+
+	var rows [][]float64
+	if opts.input != "" {
+		mapping.Init(mappingPath)
+		if rows, err = sampleRows(opts.input, opts.sampleRows); err != nil {
+			return err
+		}
+	} else {
+		features := opts.features
+		if features == 0 {
+			if features, err = modelFeatures(addrs[0]); err != nil {
+				return err
+			}
+		}
+		rows = syntheticRows(1000, features)
+	}
+
+	// Errors are part of what is measured, so they are not retried.
+	maxRetries = 0
+
+	var results []benchResult
+	for _, size := range sizes {
+		logger.WithFields(logrus.Fields{"batch_size": size, "duration": opts.duration.String()}).Info("bench batch size")
+		r := benchBatchSize(rows, size, opts)
+		warnUnreachableQPS(r, opts)
+		results = append(results, r)
+	}
+
+	switch opts.format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "table":
+		return printBench(os.Stdout, results)
+	default:
+		return fmt.Errorf("unknown format %q", opts.format)
+	}
+}
+
+// benchBatchSize feeds rows through the batch processor's workers for
+// opts.duration and summarizes the run report.
+func benchBatchSize(rows [][]float64, size int64, opts benchOptions) benchResult {
+	report = newRunReport()
+	sizer = newFixedBatchSizer(size)
+	limiter = newThrottle(opts.qps, 0, int(size))
+	// Pace calls evenly at -qps rather than letting a second's worth through
+	// at once.
+	limiter.requests.SetBurst(1)
+	concurrency = newFixedConcurrency(opts.concurrency)
+
+	in := make(chan request)
+	out := make(chan response, opts.concurrency)
+
+	go func() {
+		defer close(in)
+		deadline := time.After(opts.duration)
+		for i := 0; ; i++ {
+			select {
+			case in <- request{EntityKey: strconv.Itoa(i), Tensor: rows[i%len(rows)]}:
+			case <-deadline:
+				return
+			}
+		}
+	}()
+	go startRequest(context.Background(), opts.concurrency, in, out)
+	for range out {
+	}
+
+	r := report.JSON(time.Now(), nil)
+	result := benchResult{
+		BatchSize:      size,
+		Requests:       r.Requests,
+		RowsPerSec:     r.RowsPerSecond,
+		FailuresByCode: r.FailuresByCode,
+		Latency:        r.Latency,
+	}
+	if r.DurationSeconds > 0 {
+		result.RequestsPerSec = float64(r.Requests) / r.DurationSeconds
+	}
+	if total := r.ScoredRows + r.FailedRows; total > 0 {
+		result.ErrorRate = float64(r.FailedRows) / float64(total)
+	}
+	return result
+}
+
+// warnUnreachableQPS warns when -qps was not reached, as -concurrency calls in
+// flight allow at most about concurrency / latency calls per second.
+func warnUnreachableQPS(r benchResult, opts benchOptions) {
+	if opts.qps <= 0 || r.RequestsPerSec >= 0.9*opts.qps {
+		return
+	}
+	fields := logrus.Fields{"batch_size": r.BatchSize, "qps": opts.qps, "requests_per_second": r.RequestsPerSec}
+	if r.Latency.P50 > 0 {
+		fields["max_qps"] = float64(opts.concurrency) / (r.Latency.P50 / 1000)
+	}
+	logger.WithFields(fields).Warn("target QPS not reached, raise -concurrency")
+}
+
+func printBench(out io.Writer, results []benchResult) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BATCH\tREQUESTS\tREQ/S\tROWS/S\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%d\t%.1f\t%.1f\t%.2f%%\t%.1fms\t%.1fms\t%.1fms\t%.1fms\n",
+			r.BatchSize, r.Requests, r.RequestsPerSec, r.RowsPerSec, r.ErrorRate*100,
+			r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inferencetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseBatchSizes(t *testing.T) {
+	sizes, err := parseBatchSizes("1, 8,32")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 8, 32}, sizes)
+
+	_, err = parseBatchSizes("1,0")
+	assert.Error(t, err)
+	_, err = parseBatchSizes("8,x")
+	assert.Error(t, err)
+}
+
+func TestBenchBatchSize(t *testing.T) {
+	server := inferencetest.NewServer(nil)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	client := NewKFServingGrpcClient(1, append(server.DialOptions(), grpc.WithBlock(), grpc.WithTimeout(time.Second))...)
+	defer client.Close()
+	lb = newBalancer(client, []string{server.Addr})
+	setFlags(t, map[string]string{"m": "model"})
+
+	retries := maxRetries
+	maxRetries = 0
+	defer func() { report, maxRetries = newRunReport(), retries }()
+
+	rows := syntheticRows(10, 3)
+	opts := benchOptions{duration: 200 * time.Millisecond, concurrency: 2}
+
+	r := benchBatchSize(rows, 4, opts)
+	assert.Equal(t, int64(4), r.BatchSize)
+	assert.Greater(t, r.Requests, 0)
+	assert.Greater(t, r.RowsPerSec, r.RequestsPerSec)
+	assert.Zero(t, r.ErrorRate)
+
+	opts.qps = 5
+	r = benchBatchSize(rows, 1, opts)
+	assert.Less(t, r.RequestsPerSec, float64(10))
+
+	server.SetErrorRate(1, status.Error(codes.ResourceExhausted, "overloaded"))
+	opts.qps = 0
+	r = benchBatchSize(rows, 4, opts)
+	assert.Equal(t, float64(1), r.ErrorRate)
+	assert.Greater(t, r.FailuresByCode["ResourceExhausted"], int64(0))
+}
+
+func TestRunBenchRestoresGlobals(t *testing.T) {
+	server := inferencetest.NewServer(nil)
+	require.NoError(t, server.Start())
+	defer server.Stop()
+	setFlags(t, map[string]string{"host": server.Addr, "m": "model"})
+
+	before := struct {
+		lb          *balancer
+		retries     int
+		report      *runReport
+		sizer       *batchSizer
+		limiter     *throttle
+		concurrency *concurrencyLimiter
+	}{lb, maxRetries, report, sizer, limiter, concurrency}
+
+	require.NoError(t, runBench(benchOptions{features: 3, duration: 50 * time.Millisecond, concurrency: 1, batchSizes: "2", format: "json"}))
+
+	assert.Same(t, before.lb, lb)
+	assert.Equal(t, before.retries, maxRetries)
+	assert.Same(t, before.report, report)
+	assert.Same(t, before.sizer, sizer)
+	assert.Same(t, before.limiter, limiter)
+	assert.Same(t, before.concurrency, concurrency)
+}
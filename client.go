@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"log"
+	"net"
 	"sync"
 	"time"
 
@@ -16,38 +16,237 @@ var kfServingGrpcClient *KFServingGrpcClient
 type KFServingGrpcClient struct {
 	mutex           sync.Mutex
 	dialCallOptions []grpc.DialOption
-	conns           map[string]*grpc.ClientConn
+	poolSize        int
+	pools           map[string]*connPool
+	authorities     map[string]string
+	tls             TLSOptions
 }
 
-func InitKFServingGrpcClient(d time.Duration) {
-	kfServingGrpcClient = NewKFServingGrpcClient(grpc.WithInsecure(), grpc.WithTimeout(d))
+func InitKFServingGrpcClient(d time.Duration, poolSize int, tlsOptions TLSOptions, extra ...grpc.DialOption) error {
+	transport, err := tlsOptions.DialOption()
+	if err != nil {
+		return err
+	}
+
+	options := append([]grpc.DialOption{transport, grpc.WithBlock(), grpc.WithTimeout(d)}, extra...)
+	kfServingGrpcClient = NewKFServingGrpcClient(poolSize, options...)
+	kfServingGrpcClient.tls = tlsOptions
+	return nil
 }
 
-func NewKFServingGrpcClient(callOptions ...grpc.DialOption) *KFServingGrpcClient {
+func NewKFServingGrpcClient(poolSize int, callOptions ...grpc.DialOption) *KFServingGrpcClient {
 	return &KFServingGrpcClient{
 		dialCallOptions: callOptions,
-		conns:           make(map[string]*grpc.ClientConn),
+		poolSize:        poolSize,
+		pools:           make(map[string]*connPool),
+		authorities:     make(map[string]string),
 	}
 }
 
-func (k *KFServingGrpcClient) getConnection(host string) (*grpc.ClientConn, error) {
+func (k *KFServingGrpcClient) getConnection(ctx context.Context, host string) (*grpc.ClientConn, error) {
 	k.mutex.Lock()
-	if _, ok := k.conns[host]; !ok {
-		log.Printf("dial host %s", host)
-		if conn, err := grpc.Dial(host, k.dialCallOptions...); err != nil {
+	pool, ok := k.pools[host]
+	if !ok {
+		options, err := k.authorityOptions(host)
+		if err != nil {
+			k.mutex.Unlock()
 			return nil, err
-		} else {
-			k.conns[host] = conn
 		}
-		log.Printf("dial host %s success!", host)
+		pool = newConnPool(host, k.poolSize, append(k.dialCallOptions[:len(k.dialCallOptions):len(k.dialCallOptions)], options...))
+		k.pools[host] = pool
 	}
 	k.mutex.Unlock()
-	return k.conns[host], nil
+
+	return pool.get(ctx)
 }
 
-func (k *KFServingGrpcClient) Inference(ctx context.Context, host string, r *inference.ModelInferRequest, conn *grpc.ClientConn) (*inference.ModelInferResponse, error) {
+// authorityOptions returns the dial options presenting the authority set for
+// host, if any. Over TLS the server name defaults to it, as gRPC only uses the
+// authority on plaintext connections.
+func (k *KFServingGrpcClient) authorityOptions(host string) ([]grpc.DialOption, error) {
+	a, ok := k.authorities[host]
+	if !ok {
+		return nil, nil
+	}
+	options := []grpc.DialOption{grpc.WithAuthority(a)}
+	if k.tls.enabled() && k.tls.ServerName == "" {
+		o := k.tls
+		name, _, err := net.SplitHostPort(a)
+		if err != nil {
+			name = a
+		}
+		o.ServerName = name
+		transport, err := o.DialOption()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, transport)
+	}
+	return options, nil
+}
+
+// setAuthorities sets the authority of connections to the given hosts, for
+// addresses a DNS name was expanded to. Existing connections are unaffected.
+func (k *KFServingGrpcClient) setAuthorities(authorities map[string]string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for host, a := range authorities {
+		k.authorities[host] = a
+	}
+}
+
+// Close closes every pooled connection.
+func (k *KFServingGrpcClient) Close() {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for host, pool := range k.pools {
+		pool.close()
+		delete(k.pools, host)
+	}
+}
+
+func (k *KFServingGrpcClient) Inference(ctx context.Context, host string, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
 
 	grpcClient := inference.NewGRPCInferenceServiceClient(conn)
 
 	return grpcClient.ModelInfer(ctx, r)
 }
+
+func (k *KFServingGrpcClient) ServerReady(ctx context.Context, host string) (bool, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := inference.NewGRPCInferenceServiceClient(conn).ServerReady(ctx, &inference.ServerReadyRequest{})
+	if err != nil {
+		return false, err
+	}
+	return res.Ready, nil
+}
+
+func (k *KFServingGrpcClient) ServerLive(ctx context.Context, host string) (bool, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := inference.NewGRPCInferenceServiceClient(conn).ServerLive(ctx, &inference.ServerLiveRequest{})
+	if err != nil {
+		return false, err
+	}
+	return res.Live, nil
+}
+
+func (k *KFServingGrpcClient) ModelReady(ctx context.Context, host, name, version string) (bool, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := inference.NewGRPCInferenceServiceClient(conn).ModelReady(ctx, &inference.ModelReadyRequest{
+		Name:    name,
+		Version: version,
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.Ready, nil
+}
+
+func (k *KFServingGrpcClient) ModelStatistics(ctx context.Context, host, name, version string) (*inference.ModelStatisticsResponse, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return inference.NewGRPCInferenceServiceClient(conn).ModelStatistics(ctx, &inference.ModelStatisticsRequest{
+		Name:    name,
+		Version: version,
+	})
+}
+
+func (k *KFServingGrpcClient) ModelConfig(ctx context.Context, host, name, version string) (*inference.ModelConfig, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := inference.NewGRPCInferenceServiceClient(conn).ModelConfig(ctx, &inference.ModelConfigRequest{
+		Name:    name,
+		Version: version,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Config, nil
+}
+
+func (k *KFServingGrpcClient) ServerMetadata(ctx context.Context, host string) (*inference.ServerMetadataResponse, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return inference.NewGRPCInferenceServiceClient(conn).ServerMetadata(ctx, &inference.ServerMetadataRequest{})
+}
+
+func (k *KFServingGrpcClient) ModelMetadata(ctx context.Context, host, name, version string) (*inference.ModelMetadataResponse, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	return inference.NewGRPCInferenceServiceClient(conn).ModelMetadata(ctx, &inference.ModelMetadataRequest{
+		Name:    name,
+		Version: version,
+	})
+}
+
+func (k *KFServingGrpcClient) RepositoryIndex(ctx context.Context, host, repository string, ready bool) ([]*inference.RepositoryIndexResponse_ModelIndex, error) {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := inference.NewGRPCInferenceServiceClient(conn).RepositoryIndex(ctx, &inference.RepositoryIndexRequest{
+		RepositoryName: repository,
+		Ready:          ready,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Models, nil
+}
+
+func (k *KFServingGrpcClient) RepositoryModelLoad(ctx context.Context, host, repository, name string) error {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	_, err = inference.NewGRPCInferenceServiceClient(conn).RepositoryModelLoad(ctx, &inference.RepositoryModelLoadRequest{
+		RepositoryName: repository,
+		ModelName:      name,
+	})
+	return err
+}
+
+func (k *KFServingGrpcClient) RepositoryModelUnload(ctx context.Context, host, repository, name string) error {
+	conn, err := k.getConnection(ctx, host)
+	if err != nil {
+		return err
+	}
+
+	_, err = inference.NewGRPCInferenceServiceClient(conn).RepositoryModelUnload(ctx, &inference.RepositoryModelUnloadRequest{
+		RepositoryName: repository,
+		ModelName:      name,
+	})
+	return err
+}
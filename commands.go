@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// command is a subcommand of the CLI. Running the binary without one, or
+// with flags only, runs the batch processor.
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(fs *flag.FlagSet)
+	run     func(args []string) error
+}
+
+var commands []*command
+
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// execute parses args with the connection flags and the command's own flags,
+// then runs the command with the positional arguments. Flags may come before,
+// between or after the positional arguments.
+func (c *command) execute(args []string) error {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	registerConnectionFlags(fs)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags]%s\n\n%s\n\nFlags:\n", os.Args[0], c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if err := initLogger(logFormat, logLevel); err != nil {
+		return err
+	}
+	return c.run(positional)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags]\n       %s <command> [flags]\n\nCommands:\n", os.Args[0], os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nWithout a command the batch processor runs. Flags:\n")
+	flag.PrintDefaults()
+}
+
+// registerConnectionFlags adds the flags every command needs to reach the
+// inference server.
+func registerConnectionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&host, "host", "", "The hostname for the seldon model to send the request to, which can be the ingress of the Seldon model or the service itself. A comma-separated list or a DNS name with several A records balances across all of them")
+	fs.StringVar(&modelName, "m", "", "model name")
+	fs.StringVar(&modelVersion, "model-version", "", "model version, the server picks one when empty")
+	fs.IntVar(&poolSize, "pool", 4, "The number of gRPC connections per host shared by all workers")
+	fs.DurationVar(&dialTimeout, "dial-timeout", 10*time.Second, "How long to wait for a gRPC connection to be established")
+	fs.BoolVar(&tlsOptions.Enabled, "tls", false, "Use TLS with the system root CAs, implied by any other TLS flag")
+	fs.StringVar(&tlsOptions.CAFile, "ca-cert", "", "PEM CA bundle used to verify the server certificate")
+	fs.StringVar(&tlsOptions.CertFile, "client-cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&tlsOptions.KeyFile, "client-key", "", "PEM client private key for mutual TLS")
+	fs.StringVar(&tlsOptions.ServerName, "server-name", "", "Override the server name used to verify the server certificate, the -host name by default even when it resolves to several addresses")
+	fs.BoolVar(&tlsOptions.InsecureSkipVerify, "insecure-skip-verify", false, "Skip server certificate verification")
+	fs.Var(headers, "header", "Extra gRPC metadata in k=v form sent with every call, may be repeated")
+	fs.StringVar(&authority, "authority", "", "Override the :authority header, e.g. the Host the ingress routes on")
+	fs.StringVar(&tokens.token, "token", "", "Bearer token sent in the Authorization header")
+	fs.StringVar(&tokens.env, "token-env", "", "Environment variable holding the bearer token")
+	fs.StringVar(&tokens.file, "token-file", "", "File holding the bearer token, re-read when it changes")
+	fs.StringVar(&compression, "grpc-compression", "", "Compress requests with the given codec, only gzip is supported")
+	fs.IntVar(&maxSendMsgSize, "max-send-msg-size", 4<<20, "Maximum request size in bytes, larger chunks are split before sending. 0 or less keeps the gRPC default and does not split")
+	fs.IntVar(&maxRecvMsgSize, "max-recv-msg-size", 4<<20, "Maximum response size in bytes, 0 or less keeps the gRPC default")
+	fs.StringVar(&logFormat, "log-format", "logfmt", "Log output format: logfmt or json")
+	fs.StringVar(&logLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+}
+
+// connect sets up kfServingGrpcClient from the connection flags and returns
+// the endpoints -host resolves to.
+func connect() ([]string, error) {
+	var dialOptions []grpc.DialOption
+	if authority != "" {
+		dialOptions = append(dialOptions, grpc.WithAuthority(authority))
+	}
+	if len(headers) > 0 || tokens.token != "" || tokens.env != "" || tokens.file != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(&callCredentials{headers: headers, tokens: &tokens}))
+	}
+
+	var callOptions []grpc.CallOption
+	if maxRecvMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(maxRecvMsgSize))
+	}
+	if maxSendMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(maxSendMsgSize))
+	}
+	switch compression {
+	case "":
+	case gzip.Name:
+		callOptions = append(callOptions, grpc.UseCompressor(gzip.Name))
+	default:
+		return nil, fmt.Errorf("unsupported grpc compression %q", compression)
+	}
+	dialOptions = append(dialOptions, grpc.WithDefaultCallOptions(callOptions...))
+
+	if err := InitKFServingGrpcClient(dialTimeout, poolSize, tlsOptions, dialOptions...); err != nil {
+		return nil, err
+	}
+
+	addrs, err := resolveHosts(host)
+	if err != nil {
+		kfServingGrpcClient.Close()
+		return nil, err
+	}
+	return addrs, nil
+}
+
+// resolveHosts resolves a host list into endpoints. Connections to the
+// addresses a DNS name expands to keep the name as their authority, so that
+// TLS verifies the server certificate against it, unless -authority is set.
+func resolveHosts(hosts string) ([]string, error) {
+	addrs, authorities, err := resolveEndpoints(hosts, net.LookupHost)
+	if err != nil {
+		return nil, err
+	}
+	if authority == "" {
+		kfServingGrpcClient.setAuthorities(authorities)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// concurrencyLimiter bounds the number of ModelInfer calls in flight. When
+// adaptive, the bound follows AIMD: it grows by about one per round trip
+// while latency stays within tolerance of the best latency seen, and is cut
+// multiplicatively on overload errors or latency spikes. It only gates the
+// -w workers, each with at most one call in flight, so max is -w.
+type concurrencyLimiter struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	adaptive  bool
+	limit     float64
+	min, max  float64
+	tolerance float64
+	backoff   float64
+
+	inFlight     int
+	minLatency   time.Duration
+	lastDecrease time.Time
+}
+
+func newFixedConcurrency(n int) *concurrencyLimiter {
+	return newConcurrencyLimiter(false, n, n, n, 0)
+}
+
+func newConcurrencyLimiter(adaptive bool, initial, min, max int, tolerance float64) *concurrencyLimiter {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	c := &concurrencyLimiter{
+		adaptive:  adaptive,
+		limit:     math.Max(float64(min), math.Min(float64(initial), float64(max))),
+		min:       float64(min),
+		max:       float64(max),
+		tolerance: tolerance,
+		backoff:   0.75,
+	}
+	c.cond = sync.NewCond(&c.mutex)
+	concurrencyLimit.Set(c.limit)
+	return c
+}
+
+// Acquire blocks until another call may be sent or ctx is done.
+func (c *concurrencyLimiter) Acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.inFlight >= int(c.limit) {
+		// sync.Cond cannot wait on ctx, so wake the waiters when it is done.
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.mutex.Lock()
+				c.cond.Broadcast()
+				c.mutex.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+	for c.inFlight >= int(c.limit) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.cond.Wait()
+	}
+	c.inFlight++
+	return nil
+}
+
+func overloaded(err error) bool {
+	switch status.Code(err) {
+	case codes.ResourceExhausted, codes.DeadlineExceeded, codes.Unavailable:
+		return true
+	}
+	return false
+}
+
+// Release returns the slot taken by Acquire and adapts the limit to the
+// outcome of the call.
+func (c *concurrencyLimiter) Release(latency time.Duration, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	defer c.cond.Broadcast()
+
+	c.inFlight--
+	if !c.adaptive {
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case err != nil && !overloaded(err):
+		return
+	case err != nil:
+		c.decrease(now, latency)
+	default:
+		// Let the baseline creep up slowly so that it follows the server
+		// when its unloaded latency changes.
+		if c.minLatency == 0 || latency < c.minLatency {
+			c.minLatency = latency
+		} else {
+			c.minLatency += c.minLatency / 1000
+		}
+
+		if float64(latency) > float64(c.minLatency)*c.tolerance {
+			c.decrease(now, latency)
+		} else {
+			c.limit = math.Min(c.max, c.limit+1/c.limit)
+		}
+	}
+	concurrencyLimit.Set(c.limit)
+}
+
+// decrease cuts the limit at most once per round trip, so that a burst of
+// slow responses caused by one overload only backs off once.
+func (c *concurrencyLimiter) decrease(now time.Time, latency time.Duration) {
+	if now.Sub(c.lastDecrease) < latency {
+		return
+	}
+	c.lastDecrease = now
+	c.limit = math.Max(c.min, c.limit*c.backoff)
+	logger.WithField("limit", int(c.limit)).Debug("decrease concurrency limit")
+}
+
+func (c *concurrencyLimiter) Limit() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return int(c.limit)
+}
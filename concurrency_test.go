@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	c := newConcurrencyLimiter(true, 2, 1, 10, 2)
+
+	for i := 0; i < 50; i++ {
+		c.Acquire(context.Background())
+		c.Release(10*time.Millisecond, nil)
+	}
+	grown := c.Limit()
+	assert.Greater(t, grown, 2, "grows while latency is flat")
+	assert.LessOrEqual(t, grown, 10)
+
+	c.Acquire(context.Background())
+	c.Release(time.Millisecond, status.Error(codes.ResourceExhausted, "busy"))
+	assert.Less(t, c.Limit(), grown, "backs off on overload")
+
+	limit := c.Limit()
+	c.Acquire(context.Background())
+	c.Release(time.Millisecond, errors.New("bad input"))
+	assert.Equal(t, limit, c.Limit(), "ignores errors unrelated to load")
+
+	c.lastDecrease = time.Time{}
+	c.Acquire(context.Background())
+	c.Release(100*time.Millisecond, nil)
+	assert.Less(t, c.Limit(), limit, "backs off on latency spikes")
+
+	for i := 0; i < 100; i++ {
+		c.lastDecrease = time.Time{}
+		c.Acquire(context.Background())
+		c.Release(time.Millisecond, status.Error(codes.Unavailable, "down"))
+	}
+	assert.Equal(t, 1, c.Limit(), "never drops below the minimum")
+}
+
+func TestFixedConcurrency(t *testing.T) {
+	c := newFixedConcurrency(2)
+	c.Acquire(context.Background())
+	c.Acquire(context.Background())
+
+	acquired := make(chan struct{})
+	go func() {
+		c.Acquire(context.Background())
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a third slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.Release(time.Second, status.Error(codes.ResourceExhausted, "busy"))
+	<-acquired
+	assert.Equal(t, 2, c.Limit())
+}
+
+func TestConcurrencyAcquireContext(t *testing.T) {
+	c := newFixedConcurrency(1)
+	require.NoError(t, c.Acquire(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() { acquired <- c.Acquire(ctx) }()
+	cancel()
+	assert.ErrorIs(t, <-acquired, context.Canceled, "stops waiting when ctx is done")
+
+	assert.ErrorIs(t, c.Acquire(ctx), context.Canceled, "fails right away on a done ctx")
+
+	c.Release(time.Millisecond, nil)
+	assert.NoError(t, c.Acquire(context.Background()), "canceled waits took no slot")
+}
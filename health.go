@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var errUnhealthy = errors.New("unhealthy")
+
+func init() {
+	var (
+		format  string
+		timeout time.Duration
+	)
+	commands = append(commands, &command{
+		name:    "health",
+		summary: "Check ServerLive, ServerReady and ModelReady on every host, exiting non-zero if anything is unhealthy",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&format, "format", "table", "Output format: table or json")
+			fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout of each check")
+		},
+		run: func([]string) error {
+			return runHealth(format, timeout)
+		},
+	})
+}
+
+type hostHealth struct {
+	Host       string `json:"host"`
+	Live       bool   `json:"live"`
+	Ready      bool   `json:"ready"`
+	Model      string `json:"model,omitempty"`
+	Version    string `json:"version,omitempty"`
+	ModelReady *bool  `json:"model_ready,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (h hostHealth) healthy() bool {
+	return h.Live && h.Ready && (h.ModelReady == nil || *h.ModelReady)
+}
+
+// checkHostHealth runs every check on host, recording the first error.
+func checkHostHealth(client *KFServingGrpcClient, host, model, version string, timeout time.Duration) hostHealth {
+	h := hostHealth{Host: host, Model: model, Version: version}
+
+	call := func(f func(ctx context.Context) (bool, error)) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		ok, err := f(ctx)
+		if err != nil && h.Error == "" {
+			h.Error = err.Error()
+		}
+		return ok
+	}
+
+	h.Live = call(func(ctx context.Context) (bool, error) { return client.ServerLive(ctx, host) })
+	h.Ready = call(func(ctx context.Context) (bool, error) { return client.ServerReady(ctx, host) })
+	if model != "" {
+		ready := call(func(ctx context.Context) (bool, error) { return client.ModelReady(ctx, host, model, version) })
+		h.ModelReady = &ready
+	}
+	return h
+}
+
+func runHealth(format string, timeout time.Duration) error {
+	addrs, err := connect()
+	if err != nil {
+		return err
+	}
+	defer kfServingGrpcClient.Close()
+
+	var (
+		results = make([]hostHealth, 0, len(addrs))
+		healthy = true
+	)
+	for _, addr := range addrs {
+		h := checkHostHealth(kfServingGrpcClient, addr, modelName, modelVersion, timeout)
+		healthy = healthy && h.healthy()
+		results = append(results, h)
+	}
+
+	if err := printHealth(format, results); err != nil {
+		return err
+	}
+	if !healthy {
+		return errUnhealthy
+	}
+	return nil
+}
+
+func printHealth(format string, results []hostHealth) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tLIVE\tREADY\tMODEL\tMODEL READY\tERROR")
+		for _, h := range results {
+			modelReady := "-"
+			if h.ModelReady != nil {
+				modelReady = fmt.Sprint(*h.ModelReady)
+			}
+			model := h.Model
+			if h.Version != "" {
+				model += ":" + h.Version
+			}
+			if model == "" {
+				model = "-"
+			}
+			fmt.Fprintf(w, "%s\t%v\t%v\t%s\t%s\t%s\n", h.Host, h.Live, h.Ready, model, modelReady, h.Error)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
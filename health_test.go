@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type healthServer struct {
+	inference.UnimplementedGRPCInferenceServiceServer
+	models map[string]bool
+}
+
+func (*healthServer) ServerLive(context.Context, *inference.ServerLiveRequest) (*inference.ServerLiveResponse, error) {
+	return &inference.ServerLiveResponse{Live: true}, nil
+}
+
+func (*healthServer) ServerReady(context.Context, *inference.ServerReadyRequest) (*inference.ServerReadyResponse, error) {
+	return &inference.ServerReadyResponse{Ready: true}, nil
+}
+
+func (s *healthServer) ModelReady(_ context.Context, r *inference.ModelReadyRequest) (*inference.ModelReadyResponse, error) {
+	ready, ok := s.models[r.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "model %s not found", r.Name)
+	}
+	return &inference.ModelReadyResponse{Ready: ready}, nil
+}
+
+func TestCheckHostHealth(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	inference.RegisterGRPCInferenceServiceServer(s, &healthServer{models: map[string]bool{"up": true, "loading": false}})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	client := NewKFServingGrpcClient(1, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	defer client.Close()
+	host := lis.Addr().String()
+
+	h := checkHostHealth(client, host, "", "", time.Second)
+	assert.True(t, h.healthy())
+	assert.Nil(t, h.ModelReady)
+
+	h = checkHostHealth(client, host, "up", "1", time.Second)
+	assert.True(t, h.healthy())
+
+	h = checkHostHealth(client, host, "loading", "", time.Second)
+	assert.False(t, h.healthy())
+	assert.Empty(t, h.Error)
+
+	h = checkHostHealth(client, host, "missing", "", time.Second)
+	assert.False(t, h.healthy())
+	assert.Contains(t, h.Error, "not found")
+}
+
+func TestWaitReadyStopsDialingAtTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	host := lis.Addr().String()
+	lis.Close()
+
+	client := NewKFServingGrpcClient(1, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Minute))
+	defer client.Close()
+
+	start := time.Now()
+	err = waitReady(client, []string{host}, "model", "", 200*time.Millisecond, 100*time.Millisecond)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start).Seconds(), 10.0, "the dial timeout does not outlast the wait")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kfserving-inference-client/inference"
+	"kfserving-inference-client/mapping"
+
+	"github.com/golang/protobuf/jsonpb"
+)
+
+func init() {
+	var (
+		format    string
+		timeout   time.Duration
+		entityKey string
+	)
+	commands = append(commands, &command{
+		name:    "infer",
+		args:    " '{\"feature\": value, ...}' | feature=value ...",
+		summary: "Score a single row given on the command line and print the full response",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&mappingPath, "mapping_path", ".", "The feature mapping csv file path")
+			fs.StringVar(&format, "format", "table", "Output format: table or json, the ModelInferResponse as protobuf JSON")
+			fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of the ModelInfer call")
+			fs.StringVar(&entityKey, "entity-key", "", "Entity key of the row, only used in logs")
+		},
+		run: func(args []string) error {
+			features, err := parseFeatures(args)
+			if err != nil {
+				return err
+			}
+			return runInfer(features, entityKey, format, timeout)
+		},
+	})
+}
+
+// feature is one named input value, in the order of the input file columns.
+type feature struct {
+	name  string
+	value string
+}
+
+// parseFeatures reads the features either from a single JSON object or from
+// name=value arguments. Both keep the order they are given in, which must be
+// the column order of the input file the model was trained on.
+func parseFeatures(args []string) ([]feature, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing features")
+	}
+	if len(args) == 1 && strings.HasPrefix(strings.TrimSpace(args[0]), "{") {
+		return parseFeaturesJSON(args[0])
+	}
+
+	features := make([]feature, 0, len(args))
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid feature %q, expected name=value", arg)
+		}
+		features = append(features, feature{name: arg[:i], value: arg[i+1:]})
+	}
+	return features, nil
+}
+
+func parseFeaturesJSON(s string) ([]feature, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("parse features: %w", err)
+	}
+
+	var features []feature
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parse features: %w", err)
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("parse feature %v: %w", key, err)
+		}
+
+		f := feature{name: key.(string)}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			f.value = v
+		case json.Number:
+			f.value = v.String()
+		case bool:
+			f.value = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("feature %s is not a scalar", f.name)
+		}
+		features = append(features, f)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("parse features: %w", err)
+	}
+	return features, nil
+}
+
+func runInfer(features []feature, entityKey, format string, timeout time.Duration) error {
+	addrs, err := connect()
+	if err != nil {
+		return err
+	}
+	defer kfServingGrpcClient.Close()
+	mapping.Init(mappingPath)
+
+	r := request{EntityKey: entityKey, Tensor: make([]float64, 0, len(features))}
+	for _, f := range features {
+		r.Tensor = append(r.Tensor, mapping.GetFeatureMapping(f.name, f.value))
+	}
+	chunk := NewRequestChunk()
+	chunk.AddRecord(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.WithField("host", addrs[0]).WithField("entity_key", entityKey).Debug("send ModelInfer")
+	res, err := kfServingGrpcClient.Inference(ctx, addrs[0], newInferRequest(chunk))
+	if err != nil {
+		return fmt.Errorf("ModelInfer: %w", err)
+	}
+
+	switch format {
+	case "json":
+		m := jsonpb.Marshaler{Indent: "  ", OrigName: true}
+		if err := m.Marshal(os.Stdout, res); err != nil {
+			return err
+		}
+		fmt.Println()
+		return nil
+	case "table":
+		return printInferResponse(os.Stdout, res)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func printInferResponse(out io.Writer, res *inference.ModelInferResponse) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Model:\t%s\n", res.ModelName)
+	fmt.Fprintf(w, "Version:\t%s\n", res.ModelVersion)
+	if res.Id != "" {
+		fmt.Fprintf(w, "ID:\t%s\n", res.Id)
+	}
+	for _, k := range sortedKeys(res.Parameters) {
+		fmt.Fprintf(w, "Parameter %s:\t%s\n", k, parameterString(res.Parameters[k]))
+	}
+
+	fmt.Fprintln(w, "\nOUTPUT\tDATATYPE\tSHAPE\tVALUES")
+	for i, o := range res.Outputs {
+		var raw []byte
+		if i < len(res.RawOutputContents) {
+			raw = res.RawOutputContents[i]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", o.Name, o.Datatype, o.Shape, outputValues(o, raw))
+		for _, k := range sortedKeys(o.Parameters) {
+			fmt.Fprintf(w, "  %s\t%s\t\t\n", k, parameterString(o.Parameters[k]))
+		}
+	}
+	return w.Flush()
+}
+
+func sortedKeys(m map[string]*inference.InferParameter) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parameterString(p *inference.InferParameter) string {
+	switch v := p.GetParameterChoice().(type) {
+	case *inference.InferParameter_BoolParam:
+		return fmt.Sprint(v.BoolParam)
+	case *inference.InferParameter_Int64Param:
+		return fmt.Sprint(v.Int64Param)
+	case *inference.InferParameter_StringParam:
+		return v.StringParam
+	}
+	return ""
+}
+
+// outputValues formats the values of an output tensor, whether the server
+// sent them as typed contents or as raw little-endian bytes. BYTES elements
+// are quoted.
+func outputValues(o *inference.ModelInferResponse_InferOutputTensor, raw []byte) string {
+	if c := o.Contents; c != nil {
+		if len(c.ByteContents) > 0 {
+			return quoteBytes(c.ByteContents)
+		}
+		for _, v := range []interface{}{c.Fp64Contents, c.Fp32Contents, c.Int64Contents, c.IntContents, c.Uint64Contents, c.UintContents, c.BoolContents} {
+			if s := fmt.Sprint(v); s != "[]" {
+				return s
+			}
+		}
+	}
+	if len(raw) == 0 {
+		return "[]"
+	}
+
+	switch o.Datatype {
+	case "FP64":
+		return fmt.Sprint(decodeFP64(raw))
+	case "FP32":
+		values := make([]float32, len(raw)/4)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+		}
+		return fmt.Sprint(values)
+	case "INT64":
+		values := make([]int64, len(raw)/8)
+		for i := range values {
+			values[i] = int64(binary.LittleEndian.Uint64(raw[i*8:]))
+		}
+		return fmt.Sprint(values)
+	case "INT32":
+		values := make([]int32, len(raw)/4)
+		for i := range values {
+			values[i] = int32(binary.LittleEndian.Uint32(raw[i*4:]))
+		}
+		return fmt.Sprint(values)
+	case "BYTES":
+		// Every element is prefixed with its length as a 4-byte
+		// little-endian integer.
+		var values [][]byte
+		rest := raw
+		for len(rest) >= 4 {
+			n := binary.LittleEndian.Uint32(rest)
+			if uint64(n) > uint64(len(rest)-4) {
+				break
+			}
+			values = append(values, rest[4:4+n])
+			rest = rest[4+n:]
+		}
+		if len(rest) == 0 {
+			return quoteBytes(values)
+		}
+	}
+	return fmt.Sprintf("<%d raw bytes>", len(raw))
+}
+
+// decodeFP64 decodes raw little-endian FP64 contents.
+func decodeFP64(raw []byte) []float64 {
+	values := make([]float64, len(raw)/8)
+	for i := range values {
+		values[i] = math.Float64frombits(binary.LittleEndian.Uint64(raw[i*8:]))
+	}
+	return values
+}
+
+func quoteBytes(values [][]byte) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(string(v))
+	}
+	return "[" + strings.Join(quoted, " ") + "]"
+}
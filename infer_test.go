@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeatures(t *testing.T) {
+	features, err := parseFeatures([]string{`{"city": "beijing", "age": 31, "vip": true, "score": null}`})
+	require.NoError(t, err)
+	assert.Equal(t, []feature{{"city", "beijing"}, {"age", "31"}, {"vip", "true"}, {"score", ""}}, features)
+
+	features, err = parseFeatures([]string{"city=beijing", "age=31", "expr=a=b"})
+	require.NoError(t, err)
+	assert.Equal(t, []feature{{"city", "beijing"}, {"age", "31"}, {"expr", "a=b"}}, features)
+
+	_, err = parseFeatures(nil)
+	assert.Error(t, err)
+	_, err = parseFeatures([]string{"city"})
+	assert.Error(t, err)
+	_, err = parseFeatures([]string{`{"city": ["beijing"]}`})
+	assert.Error(t, err)
+	_, err = parseFeatures([]string{`{"city": "beijing"`})
+	assert.Error(t, err)
+}
+
+func TestPrintInferResponse(t *testing.T) {
+	raw := make([]byte, 16)
+	binary.LittleEndian.PutUint64(raw, math.Float64bits(0.25))
+	binary.LittleEndian.PutUint64(raw[8:], math.Float64bits(0.75))
+
+	res := &inference.ModelInferResponse{
+		ModelName:    "simple",
+		ModelVersion: "2",
+		Parameters: map[string]*inference.InferParameter{
+			"sequence_id": {ParameterChoice: &inference.InferParameter_Int64Param{Int64Param: 7}},
+		},
+		Outputs: []*inference.ModelInferResponse_InferOutputTensor{
+			{Name: "label", Datatype: "INT64", Shape: []int64{1, 1}, Contents: &inference.InferTensorContents{Int64Contents: []int64{1}}},
+			{Name: "probabilities", Datatype: "FP64", Shape: []int64{1, 2}},
+		},
+		RawOutputContents: [][]byte{nil, raw},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printInferResponse(&out, res))
+	assert.Contains(t, out.String(), "Version:")
+	assert.Contains(t, out.String(), "Parameter sequence_id:  7")
+	assert.Contains(t, out.String(), "label          INT64     [1 1]  [1]")
+	assert.Contains(t, out.String(), "probabilities  FP64      [1 2]  [0.25 0.75]")
+}
+
+func TestOutputValuesBytes(t *testing.T) {
+	o := &inference.ModelInferResponse_InferOutputTensor{Name: "label", Datatype: "BYTES", Shape: []int64{2}}
+	raw := []byte{3, 0, 0, 0, 'c', 'a', 't', 0, 0, 0, 0}
+	assert.Equal(t, `["cat" ""]`, outputValues(o, raw))
+	assert.Equal(t, "<5 raw bytes>", outputValues(o, raw[:5]), "truncated element")
+
+	o.Contents = &inference.InferTensorContents{ByteContents: [][]byte{[]byte("dog"), []byte("a\nb")}}
+	assert.Equal(t, `["dog" "a\nb"]`, outputValues(o, nil), "newlines are escaped")
+}
@@ -0,0 +1,128 @@
+package inferencetest
+
+import (
+	"context"
+
+	"kfserving-inference-client/inference"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Model is a live and ready server with a single model taking the FP64
+// [batch, features] tensor the client sends and returning one FP64 score per
+// row. Embed it to override single RPCs.
+type Model struct {
+	inference.UnimplementedGRPCInferenceServiceServer
+
+	// Name and Version default to "model" and "1".
+	Name    string
+	Version string
+	// Features is the number of features per row, any number when 0.
+	Features int64
+	// Predict scores a row, Sum when nil.
+	Predict func(row []float64) float64
+}
+
+// Sum scores a row with the sum of its features.
+func Sum(row []float64) float64 {
+	var sum float64
+	for _, f := range row {
+		sum += f
+	}
+	return sum
+}
+
+func (m *Model) name() string {
+	if m.Name == "" {
+		return "model"
+	}
+	return m.Name
+}
+
+func (m *Model) version() string {
+	if m.Version == "" {
+		return "1"
+	}
+	return m.Version
+}
+
+func (m *Model) find(name, version string) error {
+	if name != m.name() || (version != "" && version != m.version()) {
+		return status.Errorf(codes.NotFound, "model %s version %q not found", name, version)
+	}
+	return nil
+}
+
+func (m *Model) ServerLive(context.Context, *inference.ServerLiveRequest) (*inference.ServerLiveResponse, error) {
+	return &inference.ServerLiveResponse{Live: true}, nil
+}
+
+func (m *Model) ServerReady(context.Context, *inference.ServerReadyRequest) (*inference.ServerReadyResponse, error) {
+	return &inference.ServerReadyResponse{Ready: true}, nil
+}
+
+func (m *Model) ModelReady(_ context.Context, r *inference.ModelReadyRequest) (*inference.ModelReadyResponse, error) {
+	if err := m.find(r.Name, r.Version); err != nil {
+		return nil, err
+	}
+	return &inference.ModelReadyResponse{Ready: true}, nil
+}
+
+func (m *Model) ServerMetadata(context.Context, *inference.ServerMetadataRequest) (*inference.ServerMetadataResponse, error) {
+	return &inference.ServerMetadataResponse{Name: "inferencetest", Version: "1"}, nil
+}
+
+func (m *Model) ModelMetadata(_ context.Context, r *inference.ModelMetadataRequest) (*inference.ModelMetadataResponse, error) {
+	if err := m.find(r.Name, r.Version); err != nil {
+		return nil, err
+	}
+	features := m.Features
+	if features == 0 {
+		features = -1
+	}
+	return &inference.ModelMetadataResponse{
+		Name:     m.name(),
+		Versions: []string{m.version()},
+		Platform: "inferencetest",
+		Inputs:   []*inference.ModelMetadataResponse_TensorMetadata{{Name: "input-0", Datatype: "FP64", Shape: []int64{-1, features}}},
+		Outputs:  []*inference.ModelMetadataResponse_TensorMetadata{{Name: "output-0", Datatype: "FP64", Shape: []int64{-1, 1}}},
+	}, nil
+}
+
+func (m *Model) ModelInfer(_ context.Context, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	if err := m.find(r.ModelName, r.ModelVersion); err != nil {
+		return nil, err
+	}
+	if len(r.Inputs) != 1 || r.Inputs[0].Datatype != "FP64" || len(r.Inputs[0].Shape) != 2 || r.Inputs[0].Contents == nil {
+		return nil, status.Error(codes.InvalidArgument, "expected a single FP64 [batch, features] input")
+	}
+
+	rows, features := r.Inputs[0].Shape[0], r.Inputs[0].Shape[1]
+	tensor := r.Inputs[0].Contents.Fp64Contents
+	// Checked by division, as rows*features may overflow.
+	if features <= 0 || rows < 0 || int64(len(tensor))%features != 0 || int64(len(tensor))/features != rows || (m.Features > 0 && features != m.Features) {
+		return nil, status.Errorf(codes.InvalidArgument, "input has %d values for shape %v", len(tensor), r.Inputs[0].Shape)
+	}
+
+	predict := m.Predict
+	if predict == nil {
+		predict = Sum
+	}
+	scores := make([]float64, rows)
+	for i := range scores {
+		scores[i] = predict(tensor[int64(i)*features : int64(i+1)*features])
+	}
+
+	return &inference.ModelInferResponse{
+		ModelName:    m.name(),
+		ModelVersion: m.version(),
+		Id:           r.Id,
+		Outputs: []*inference.ModelInferResponse_InferOutputTensor{{
+			Name:     "output-0",
+			Datatype: "FP64",
+			Shape:    []int64{rows, 1},
+			Contents: &inference.InferTensorContents{Fp64Contents: scores},
+		}},
+	}, nil
+}
@@ -0,0 +1,165 @@
+// Package inferencetest provides a fake KServe V2 gRPC inference server for
+// tests, with injectable latency and errors and a record of every call.
+package inferencetest
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Call is one RPC received by a Server.
+type Call struct {
+	Method  string
+	Request interface{}
+	Err     error
+	Time    time.Time
+}
+
+// Server serves Service over gRPC. Every call is recorded, delayed by the
+// latency and failed at the error rate before Service sees it.
+type Server struct {
+	Service inference.GRPCInferenceServiceServer
+
+	// Addr is the address to dial once the server is started, "bufconn" for
+	// an in-memory listener.
+	Addr string
+
+	mutex     sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	err       error
+	rand      *rand.Rand
+	calls     []Call
+
+	server   *grpc.Server
+	listener net.Listener
+	bufconn  *bufconn.Listener
+}
+
+// NewServer returns a server for service, a default Model when nil.
+func NewServer(service inference.GRPCInferenceServiceServer) *Server {
+	if service == nil {
+		service = &Model{}
+	}
+	return &Server{
+		Service: service,
+		err:     status.Error(codes.Unavailable, "injected error"),
+		rand:    rand.New(rand.NewSource(1)),
+	}
+}
+
+// Start serves on a free local port.
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	s.Addr = lis.Addr().String()
+	s.serve(lis)
+	return nil
+}
+
+// StartBufconn serves on an in-memory listener, reachable through the dial
+// options returned by DialOptions.
+func (s *Server) StartBufconn() {
+	s.bufconn = bufconn.Listen(1 << 20)
+	s.Addr = "bufconn"
+	s.serve(s.bufconn)
+}
+
+func (s *Server) serve(lis net.Listener) {
+	s.listener = lis
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.intercept))
+	inference.RegisterGRPCInferenceServiceServer(s.server, s.Service)
+	go s.server.Serve(lis)
+}
+
+// DialOptions returns the options a client needs to reach the server.
+func (s *Server) DialOptions() []grpc.DialOption {
+	options := []grpc.DialOption{grpc.WithInsecure()}
+	if s.bufconn != nil {
+		options = append(options, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.bufconn.DialContext(ctx)
+		}))
+	}
+	return options
+}
+
+func (s *Server) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+// SetLatency delays every call by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	s.latency = d
+	s.mutex.Unlock()
+}
+
+// SetErrorRate fails the given fraction of calls with err, or Unavailable
+// when err is nil. Which calls fail is random but repeatable.
+func (s *Server) SetErrorRate(rate float64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.errorRate = rate
+	if err != nil {
+		s.err = err
+	}
+}
+
+// Calls returns the calls received so far to method, e.g. "ModelInfer", or
+// to every method when empty.
+func (s *Server) Calls(method string) []Call {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	s.mutex.Lock()
+	latency := s.latency
+	var err error
+	if s.errorRate > 0 && s.rand.Float64() < s.errorRate {
+		err = s.err
+	}
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	var res interface{}
+	if err == nil {
+		res, err = handler(ctx, req)
+	}
+
+	s.mutex.Lock()
+	s.calls = append(s.calls, Call{Method: path.Base(info.FullMethod), Request: req, Err: err, Time: time.Now()})
+	s.mutex.Unlock()
+	return res, err
+}
@@ -0,0 +1,95 @@
+package inferencetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func dial(t *testing.T, s *Server) inference.GRPCInferenceServiceClient {
+	conn, err := grpc.Dial(s.Addr, s.DialOptions()...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return inference.NewGRPCInferenceServiceClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer(&Model{Name: "simple", Features: 2})
+	s.StartBufconn()
+	defer s.Stop()
+	client := dial(t, s)
+	ctx := context.Background()
+
+	res, err := client.ModelInfer(ctx, &inference.ModelInferRequest{
+		ModelName: "simple",
+		Inputs: []*inference.ModelInferRequest_InferInputTensor{{
+			Datatype: "FP64",
+			Shape:    []int64{2, 2},
+			Contents: &inference.InferTensorContents{Fp64Contents: []float64{1, 2, 3, 4}},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1", res.ModelVersion)
+	assert.Equal(t, []float64{3, 7}, res.Outputs[0].Contents.Fp64Contents)
+
+	_, err = client.ModelReady(ctx, &inference.ModelReadyRequest{Name: "other"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	s.SetErrorRate(1, status.Error(codes.ResourceExhausted, "busy"))
+	_, err = client.ServerReady(ctx, &inference.ServerReadyRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	s.SetErrorRate(0, nil)
+	s.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	_, err = client.ServerLive(ctx, &inference.ServerLiveRequest{})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+
+	assert.Len(t, s.Calls(""), 4)
+	calls := s.Calls("ModelInfer")
+	require.Len(t, calls, 1)
+	assert.Equal(t, "simple", calls[0].Request.(*inference.ModelInferRequest).ModelName)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(s.Calls("ServerReady")[0].Err))
+}
+
+func TestServerStart(t *testing.T) {
+	s := NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	res, err := dial(t, s).ModelMetadata(context.Background(), &inference.ModelMetadataRequest{Name: "model"})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-1, -1}, res.Inputs[0].Shape)
+}
+
+func TestModelRejectsBadShapes(t *testing.T) {
+	m := &Model{}
+	for _, c := range []struct {
+		shape  []int64
+		values []float64
+	}{
+		{[]int64{1 << 62, 4}, nil},
+		{[]int64{-2, -2}, []float64{1, 2, 3, 4}},
+		{[]int64{1 << 62, 0}, nil},
+		{[]int64{3, 1}, []float64{1, 2, 3, 4}},
+	} {
+		_, err := m.ModelInfer(context.Background(), &inference.ModelInferRequest{
+			ModelName: "model",
+			Inputs: []*inference.ModelInferRequest_InferInputTensor{{
+				Datatype: "FP64",
+				Shape:    c.shape,
+				Contents: &inference.InferTensorContents{Fp64Contents: c.values},
+			}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", c.shape)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.New()
+
+// initLogger configures the output format, "json" or "logfmt", and the
+// minimum level of the global logger.
+func initLogger(format, level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(lvl)
+	logger.SetOutput(os.Stderr)
+
+	switch format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case "logfmt":
+		logger.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+type loggerKey struct{}
+
+// withLogger attaches entry to ctx so that code further down the call chain
+// logs with the same fields.
+func withLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+func loggerFrom(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logger)
+}
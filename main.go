@@ -4,127 +4,444 @@ import (
 	"context"
 	"encoding/csv"
 	"flag"
+	"fmt"
 	"io"
-	"log"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"kfserving-inference-client/inference"
 	"kfserving-inference-client/mapping"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cast"
-	"google.golang.org/grpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
-	inputDataPath  string
-	outputDataPath string
-	host           string
-	modelName      string
-	mappingPath    string
-	worker         int
-	batchSize      int64
+	inputDataPath    string
+	outputDataPath   string
+	host             string
+	modelName        string
+	mappingPath      string
+	worker           int
+	batchSize        int64
+	poolSize         int
+	dialTimeout      time.Duration
+	healthInterval   time.Duration
+	modelVersion     string
+	waitReadyFlag    bool
+	waitTimeout      time.Duration
+	tlsOptions       TLSOptions
+	headers          = headerFlags{}
+	authority        string
+	tokens           tokenSource
+	compression      string
+	maxSendMsgSize   int
+	maxRecvMsgSize   int
+	maxRetries       int
+	metricsAddr      string
+	traceExporter    string
+	otlpEndpoint     string
+	traceFile        string
+	reportPath       string
+	logFormat        string
+	logLevel         string
+	progressInterval time.Duration
+	serverStatsFlag  bool
+	qps              float64
+	rowsPerSec       float64
+	adminAddr        string
+
+	adaptiveConcurrency bool
+	minConcurrency      int
+	latencyTolerance    float64
+
+	autoBatch     bool
+	autoBatchMax  int64
+	latencySLO    time.Duration
+	probeRequests int64
+
+	loadModelFlag     bool
+	unloadAfter       bool
+	repository        string
+	repositoryTimeout time.Duration
+
+	candidateModel   string
+	candidateVersion string
+	candidateHost    string
+	thresholds       shadowThresholds
+
+	limiter     *throttle
+	concurrency *concurrencyLimiter
+	sizer       *batchSizer
+
+	chunkSeq int64
+
+	lb *balancer
 )
 
 func init() {
-	InitKFServingGrpcClient(time.Second * 10)
+	registerConnectionFlags(flag.CommandLine)
 
 	flag.StringVar(&inputDataPath, "i", "", "The local filestore path where the input file with the data to process is located")
 	flag.StringVar(&outputDataPath, "o", "", "The local filestore path where the output file should be written with the outputs of the batch processing")
-	flag.StringVar(&host, "host", "", "The hostname for the seldon model to send the request to, which can be the ingress of the Seldon model or the service itself ")
-	flag.StringVar(&modelName, "m", "", "model name")
 	flag.StringVar(&mappingPath, "mapping_path", ".", "The feature mapping csv file path")
-	flag.IntVar(&worker, "w", 100, "The number of parallel request processor workers to run for parallel processing")
+	flag.IntVar(&worker, "w", 100, "The number of parallel request processor workers to run for parallel processing, the upper bound with -adaptive-concurrency")
 	flag.Int64Var(&batchSize, "u", 100, "Batch size greater than 1 can be used to group multiple predictions into a single request.")
+	flag.BoolVar(&waitReadyFlag, "wait-ready", false, "Poll ServerLive, ServerReady and ModelReady on every host before reading any input")
+	flag.DurationVar(&waitTimeout, "wait-timeout", 5*time.Minute, "How long -wait-ready waits for the model to become ready")
+	flag.IntVar(&maxRetries, "retries", 0, "How many times to retry a ModelInfer call failing with a retryable gRPC code, 0 disables retries")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090, disabled when empty")
+	flag.StringVar(&traceExporter, "trace-exporter", "none", "Export OpenTelemetry spans: none, otlp or file")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "OTLP gRPC collector address, defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	flag.StringVar(&traceFile, "trace-file", "traces.json", "File spans are written to with -trace-exporter file")
+	flag.StringVar(&reportPath, "report", "", "Write a JSON summary of the run to this path")
+	flag.DurationVar(&progressInterval, "progress-interval", 10*time.Second, "How often to report progress, ETA and throughput, 0 disables it")
+	flag.BoolVar(&serverStatsFlag, "server-stats", true, "Include the ModelStatistics delta between start and end of the run in the report")
+	flag.Float64Var(&qps, "qps", 0, "Maximum ModelInfer calls per second across all workers, 0 means unlimited")
+	flag.Float64Var(&rowsPerSec, "rows-per-sec", 0, "Maximum rows per second across all workers, 0 means unlimited")
+	flag.StringVar(&adminAddr, "admin-addr", "", "Serve the admin endpoint for changing rate limits at runtime on this address, disabled when empty")
+	flag.BoolVar(&adaptiveConcurrency, "adaptive-concurrency", false, "Adapt the number of requests in flight to latency and errors instead of always running -w of them")
+	flag.IntVar(&minConcurrency, "min-concurrency", 1, "Lower bound of requests in flight with -adaptive-concurrency")
+	flag.Float64Var(&latencyTolerance, "latency-tolerance", 2, "With -adaptive-concurrency, back off when latency exceeds this multiple of the best latency seen")
+	flag.BoolVar(&autoBatch, "auto-batch", false, "Probe batch sizes at startup and keep the one with the best throughput, ignoring -u")
+	flag.Int64Var(&autoBatchMax, "auto-batch-max", 1024, "Largest batch size -auto-batch tries, further capped by the model's max_batch_size")
+	flag.DurationVar(&latencySLO, "latency-slo", 0, "Mean ModelInfer latency -auto-batch must stay under, 0 means no SLO")
+	flag.Int64Var(&probeRequests, "probe-requests", 20, "ModelInfer calls measured per batch size tried by -auto-batch")
+	flag.BoolVar(&loadModelFlag, "load-model", false, "Load the model -m, and the candidate model, from the model repository on every host before scoring")
+	flag.BoolVar(&unloadAfter, "unload-after", false, "Unload the model -m, and the candidate model, from every host once the run is over")
+	flag.StringVar(&repository, "repository", "", "Repository name used by -load-model and -unload-after, the server default when empty")
+	flag.DurationVar(&repositoryTimeout, "repository-timeout", 5*time.Minute, "Timeout of each model load or unload call of -load-model and -unload-after")
+	flag.StringVar(&candidateModel, "candidate-m", "", "Also score every chunk with this candidate model and write both predictions, defaults to -m when another candidate flag is set")
+	flag.StringVar(&candidateVersion, "candidate-version", "", "Version of the candidate model")
+	flag.StringVar(&candidateHost, "candidate-host", "", "Hosts serving the candidate model, defaults to -host")
+	flag.Float64Var(&thresholds.MaxMeanAbsDiff, "max-mean-abs-diff", 0, "Fail the run when the mean absolute difference between primary and candidate exceeds this, 0 disables it")
+	flag.Float64Var(&thresholds.MaxP99RelDiff, "max-p99-rel-diff", 0, "Fail the run when the p99 relative difference between primary and candidate exceeds this, 0 disables it")
+	flag.Float64Var(&thresholds.MinCorrelation, "min-correlation", 0, "Fail the run when the correlation between primary and candidate is below this, 0 disables it")
+	flag.Float64Var(&thresholds.MinRankCorrelation, "min-rank-correlation", 0, "Fail the run when the rank correlation between primary and candidate is below this, 0 disables it")
+	flag.Float64Var(&thresholds.MaxCandidateFailed, "max-candidate-failed", 0, "Fail the run when the candidate fails to score more than this fraction of the rows, 0 disables it")
+	flag.DurationVar(&healthInterval, "health-interval", 10*time.Second, "How often to re-resolve -host and probe ServerReady on each host when balancing across several of them")
 }
 
 func main() {
+	flag.Usage = usage
+
+	if len(os.Args) > 1 {
+		if c := lookupCommand(os.Args[1]); c != nil {
+			if err := c.execute(os.Args[2:]); err != nil {
+				logger.WithError(err).Fatalf("%s failed", c.name)
+			}
+			return
+		}
+	}
+
 	flag.Parse()
 
+	if err := initLogger(logFormat, logLevel); err != nil {
+		logger.WithError(err).Fatal("invalid logging flags")
+	}
+
+	if err := run(); err != nil {
+		logger.WithError(err).Fatal("run failed")
+	}
+}
+
+func run() error {
+	shutdownTracing, err := initTracing(context.Background(), traceExporter, otlpEndpoint, traceFile)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	if metricsAddr != "" {
+		go serveMetrics(metricsAddr)
+	}
+
+	if adaptiveConcurrency {
+		concurrency = newConcurrencyLimiter(true, minConcurrency, minConcurrency, worker, latencyTolerance)
+	} else {
+		concurrency = newFixedConcurrency(worker)
+	}
+	addrs, err := connect()
+	if err != nil {
+		return err
+	}
+	defer kfServingGrpcClient.Close()
+
 	mapping.Init(mappingPath)
 
+	// The candidate is loaded, waited for and checked like the primary model.
+	var candidateAddrs []string
+	if candidateModel != "" || candidateVersion != "" || candidateHost != "" {
+		candidate = &shadowTarget{model: candidateModel, version: candidateVersion}
+		if candidate.model == "" {
+			candidate.model = modelName
+		}
+		candidateAddrs = addrs
+		if candidateHost != "" {
+			if candidateAddrs, err = resolveHosts(candidateHost); err != nil {
+				return err
+			}
+		}
+		logger.WithFields(logrus.Fields{"model": candidate.model, "version": candidate.version, "host": candidateHost}).Info("compare with candidate model")
+	}
+	// Only another model or other hosts need their own load and unload.
+	loadCandidate := candidate != nil && (candidateHost != "" || candidate.model != modelName)
+
+	if loadModelFlag {
+		if err := loadModel(kfServingGrpcClient, addrs, repository, modelName, repositoryTimeout); err != nil {
+			return err
+		}
+	}
+	if unloadAfter {
+		defer unloadAfterRun(addrs, modelName)
+	}
+	if loadCandidate {
+		if loadModelFlag {
+			if err := loadModel(kfServingGrpcClient, candidateAddrs, repository, candidate.model, repositoryTimeout); err != nil {
+				return err
+			}
+		}
+		if unloadAfter {
+			defer unloadAfterRun(candidateAddrs, candidate.model)
+		}
+	}
+
+	if waitReadyFlag {
+		if err := waitReady(kfServingGrpcClient, addrs, modelName, modelVersion, waitTimeout, 2*time.Second); err != nil {
+			return err
+		}
+		if candidate != nil {
+			if err := waitReady(kfServingGrpcClient, candidateAddrs, candidate.model, candidate.version, waitTimeout, 2*time.Second); err != nil {
+				return err
+			}
+		}
+	}
+	lb = newBalancer(kfServingGrpcClient, addrs)
+	lb.resolve = func() ([]string, error) { return resolveHosts(host) }
+	if candidate != nil {
+		candidate.lb = lb
+		if candidateHost != "" {
+			candidate.lb = newBalancer(kfServingGrpcClient, candidateAddrs)
+			candidate.lb.resolve = func() ([]string, error) { return resolveHosts(candidateHost) }
+		}
+	}
+
+	maxModelBatch, err := checkModelConfig(addrs[0], modelName, modelVersion, inputDataPath)
+	if err != nil {
+		return err
+	}
+	if candidate != nil {
+		// Chunks go to both models, so the smaller limit applies.
+		candidateMax, err := checkModelConfig(candidateAddrs[0], candidate.model, candidate.version, inputDataPath)
+		if err != nil {
+			return err
+		}
+		if candidateMax > 0 && (maxModelBatch == 0 || candidateMax < maxModelBatch) {
+			maxModelBatch = candidateMax
+		}
+	}
+
+	if autoBatch {
+		max := autoBatchMax
+		if maxModelBatch > 0 && maxModelBatch < max {
+			max = maxModelBatch
+		}
+		sizer = newAutoBatchSizer(max, latencySLO, probeRequests)
+	} else {
+		if maxModelBatch > 0 && batchSize > maxModelBatch {
+			logger.WithFields(logrus.Fields{"batch_size": batchSize, "max_batch_size": maxModelBatch}).Warn("cap batch size at the model's max_batch_size")
+			batchSize = maxModelBatch
+		}
+		sizer = newFixedBatchSizer(batchSize)
+	}
+
+	// The rows bucket must hold the largest chunk, known only once the batch
+	// size is capped.
+	limiter = newThrottle(qps, rowsPerSec, int(sizer.Max()))
+	if adminAddr != "" {
+		go serveAdmin(adminAddr, limiter)
+	}
+
+	var statsBefore *serverStats
+	if serverStatsFlag && reportPath != "" {
+		statsBefore = snapshotStats(context.Background(), kfServingGrpcClient, addrs, modelName, modelVersion)
+	}
+
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go lb.watchHealth(healthCtx, healthInterval)
+	if candidate != nil && candidate.lb != lb {
+		go candidate.lb.watchHealth(healthCtx, healthInterval)
+	}
+
 	in := make(chan request, worker)
 	out := make(chan response, worker)
 
+	// Cancelling ctx stops the reader and the workers when reading or writing
+	// fails, the error being returned once the report is written.
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go getRequestFromFile(cancel, inputDataPath, in)
+	readErr := make(chan error, 1)
+	go func() {
+		err := getRequestFromFile(ctx, inputDataPath, in)
+		if err != nil {
+			cancel()
+		}
+		readErr <- err
+	}()
 
 	go startRequest(ctx, worker, in, out)
 
-	writeResponseToFile(outputDataPath, out)
+	progressCtx, stopProgress := context.WithCancel(context.Background())
+	go tracker.report(progressCtx, progressInterval)
+
+	ioErr := writeResponseToFile(outputDataPath, out)
+	if ioErr != nil {
+		cancel()
+		for range out {
+		}
+	}
+	stopProgress()
+	if err := <-readErr; ioErr == nil {
+		ioErr = err
+	}
+
+	if statsBefore != nil {
+		report.serverDelta(statsBefore, snapshotStats(context.Background(), kfServingGrpcClient, addrs, modelName, modelVersion))
+	}
+
+	var shadowErr error
+	if candidate != nil {
+		s := shadowScores.summary()
+		report.shadowSummary(s)
+		logger.WithFields(logrus.Fields{
+			"rows":             s.Rows,
+			"candidate_failed": s.CandidateFailed,
+			"mean_abs_diff":    s.MeanAbsDiff,
+			"p99_rel_diff":     s.P99RelDiff,
+			"correlation":      s.Correlation,
+			"rank_correlation": s.RankCorrelation,
+			"p99_latency_ms":   s.Latency.P99,
+		}).Info("candidate comparison")
+		shadowErr = s.check(thresholds)
+	}
+
+	if reportPath != "" {
+		if err := report.WriteFile(reportPath, effectiveConfig(flag.CommandLine)); err != nil {
+			return err
+		}
+	}
+	if ioErr != nil {
+		return ioErr
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d rows failed, see the log for the gRPC errors", failed)
+	}
+	return shadowErr
 }
 
 func startRequest(ctx context.Context, worker int, in <-chan request, out chan<- response) {
 	var wait sync.WaitGroup
 	for i := 0; i < worker; i++ {
 		wait.Add(1)
-		go requestWorker(ctx, &wait, in, out)
+		go requestWorker(ctx, i, &wait, in, out)
 	}
 	wait.Wait()
 	close(out)
 }
 
-func requestWorker(ctx context.Context, wait *sync.WaitGroup, in <-chan request, out chan<- response) {
+func requestWorker(ctx context.Context, id int, wait *sync.WaitGroup, in <-chan request, out chan<- response) {
 	defer wait.Done()
 
-	doRequest := func(r *RequestChunk, conn *grpc.ClientConn) {
-		res, err := kfServingGrpcClient.Inference(context.Background(), host, &inference.ModelInferRequest{
-			ModelName: modelName,
-			Inputs: []*inference.ModelInferRequest_InferInputTensor{
-				{
-					Shape:    r.Shape(),
-					Datatype: "FP64",
-					Contents: &inference.InferTensorContents{
-						Fp64Contents: r.Tensor,
-					},
-				},
-			},
-		}, conn)
+	workerLog := logger.WithField("worker", id)
+
+	var doRequest func(r *RequestChunk)
+	doRequest = func(r *RequestChunk) {
+		req := newInferRequest(r)
+		if maxSendMsgSize > 0 && proto.Size(req) > maxSendMsgSize && r.RecordCount > 1 {
+			left, right := r.Split()
+			doRequest(left)
+			doRequest(right)
+			return
+		}
+
+		log := workerLog.WithField("chunk", atomic.AddInt64(&chunkSeq, 1))
+		spanCtx, span := tracer.Start(withLogger(ctx, log), "chunk", trace.WithAttributes(
+			attribute.String("model", modelName),
+			attribute.String("version", modelVersion),
+			attribute.Int64("batch_size", r.RecordCount),
+		))
+		defer span.End()
+
+		batchSizes.Observe(float64(r.RecordCount))
+		res, candidateScores, latency, err := inferChunk(spanCtx, r, req)
+		var values []float64
+		if err == nil {
+			values, err = scores(res, r.RecordCount)
+		}
 		if err != nil {
-			panic(err)
+			log.WithField("rows", r.RecordCount).WithError(err).Error("drop chunk after ModelInfer failed")
+			rowsFailed.Add(float64(r.RecordCount))
+			report.failure(r.RecordCount, err)
+			tracker.done(r.RecordCount)
+			return
 		}
+		report.success(r.RecordCount, res.ModelName, res.ModelVersion)
+		sizer.Observe(r.RecordCount, latency)
 
-		for i, content := range res.Outputs[0].Contents.Fp64Contents {
-			out <- response{
+		lastScored.SetToCurrentTime()
+		for i, value := range values {
+			rowsScored.Inc()
+			resp := response{
 				EntityKey:         r.EntityKey[i],
-				InferenceResponse: cast.ToFloat64(content),
+				InferenceResponse: value,
 			}
+			if candidateScores != nil {
+				resp.Candidate = &candidateScores[i]
+			}
+			out <- resp
 		}
 	}
 
-	conn, err := grpc.Dial(host, grpc.WithInsecure(), grpc.WithTimeout(time.Second*5), grpc.WithBlock())
-	if err != nil {
-		panic(err)
-	}
-	defer conn.Close()
-
 	var (
 		chunk = NewRequestChunk()
 	)
 	for {
 		select {
-		case r := <-in:
+		case r, ok := <-in:
+			if !ok {
+				if chunk.RecordCount > 0 {
+					doRequest(chunk)
+				}
+				return
+			}
 			chunk.AddRecord(request{
 				EntityKey: r.EntityKey,
 				Tensor:    r.Tensor,
 			})
 
-			if chunk.RecordCount == batchSize {
-				doRequest(chunk, conn)
+			if chunk.RecordCount >= sizer.Size() {
+				doRequest(chunk)
 				chunk = NewRequestChunk()
 			}
 		case <-ctx.Done():
-			for r := range in {
-				chunk.AddRecord(request{
-					EntityKey: r.EntityKey,
-					Tensor:    r.Tensor,
-				})
+			// The run is aborted, the rows read but not sent fail.
+			rows := chunk.RecordCount
+			for range in {
+				rows++
 			}
-
-			if chunk.RecordCount > 0 {
-				doRequest(chunk, conn)
+			if rows > 0 {
+				rowsFailed.Add(float64(rows))
+				report.failure(rows, ctx.Err())
+				tracker.done(rows)
 			}
 			return
 		}
@@ -134,6 +451,7 @@ func requestWorker(ctx context.Context, wait *sync.WaitGroup, in <-chan request,
 type response struct {
 	EntityKey         string
 	InferenceResponse float64
+	Candidate         *float64
 }
 
 type request struct {
@@ -161,6 +479,67 @@ func (r *RequestChunk) Shape() []int64 {
 	return []int64{r.RecordCount, r.TensorSize}
 }
 
+// Split divides the chunk into two halves by record.
+func (r *RequestChunk) Split() (*RequestChunk, *RequestChunk) {
+	half := r.RecordCount / 2
+	at := half * r.TensorSize
+
+	left := &RequestChunk{
+		EntityKey:   r.EntityKey[:half],
+		Tensor:      r.Tensor[:at],
+		RecordCount: half,
+		TensorSize:  r.TensorSize,
+	}
+	right := &RequestChunk{
+		EntityKey:   r.EntityKey[half:],
+		Tensor:      r.Tensor[at:],
+		RecordCount: r.RecordCount - half,
+		TensorSize:  r.TensorSize,
+	}
+	return left, right
+}
+
+func newInferRequest(r *RequestChunk) *inference.ModelInferRequest {
+	return newModelInferRequest(r, modelName, modelVersion)
+}
+
+func newModelInferRequest(r *RequestChunk, model, version string) *inference.ModelInferRequest {
+	return &inference.ModelInferRequest{
+		ModelName:    model,
+		ModelVersion: version,
+		Inputs: []*inference.ModelInferRequest_InferInputTensor{
+			{
+				Shape:    r.Shape(),
+				Datatype: "FP64",
+				Contents: &inference.InferTensorContents{
+					Fp64Contents: r.Tensor,
+				},
+			},
+		},
+	}
+}
+
+// scores returns the FP64 scores of the first output of res, whether the
+// server sent them as typed contents or as raw bytes, and fails unless there
+// is exactly one per row.
+func scores(res *inference.ModelInferResponse, rows int64) ([]float64, error) {
+	if len(res.GetOutputs()) == 0 {
+		return nil, status.Error(codes.Internal, "response has no outputs")
+	}
+	output := res.Outputs[0]
+	values := output.GetContents().GetFp64Contents()
+	if len(values) == 0 && len(res.RawOutputContents) > 0 {
+		if output.Datatype != "FP64" {
+			return nil, status.Errorf(codes.Internal, "output %s is %s, want FP64", output.Name, output.Datatype)
+		}
+		values = decodeFP64(res.RawOutputContents[0])
+	}
+	if int64(len(values)) != rows {
+		return nil, status.Errorf(codes.Internal, "output %s has %d values for %d rows", output.Name, len(values), rows)
+	}
+	return values, nil
+}
+
 func NewRequestChunk() *RequestChunk {
 	return &RequestChunk{
 		EntityKey: []string{},
@@ -168,68 +547,93 @@ func NewRequestChunk() *RequestChunk {
 	}
 }
 
-func getRequestFromFile(cancel context.CancelFunc, filePath string, records chan<- request) {
-	defer cancel()
+// getRequestFromFile sends the rows of the input file to records, closing it
+// once the file is read, it fails or ctx is done.
+func getRequestFromFile(ctx context.Context, filePath string, records chan<- request) error {
+	defer close(records)
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("open input file: %w", err)
 	}
 	defer file.Close()
 
-	csvr := csv.NewReader(file)
+	csvr := csv.NewReader(tracker.input(file))
 
 	head, err := csvr.Read()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("read header of %s: %w", filePath, err)
 	}
 	for {
 		row, err := csvr.Read()
 		if err == io.EOF {
-			err = nil
-			return
+			return nil
 		} else if err != nil {
-			panic(err)
+			return fmt.Errorf("read %s: %w", filePath, err)
 		}
 
-		var (
-			entityKey string
-			tensor    = make([]float64, 0, len(row)-1)
-		)
-		for i, value := range row {
-			if i == 0 {
-				entityKey = value
-				continue
-			}
-			tensor = append(tensor, mapping.GetFeatureMapping(head[i], value))
+		rowsRead.Inc()
+		report.read()
+		select {
+		case records <- mapRow(head, row):
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
+}
 
-		records <- request{
-			EntityKey: entityKey,
-			Tensor:    tensor,
+// mapRow turns an input row into a request, the first column being the entity
+// key and the others features mapped through the mapping package.
+func mapRow(head, row []string) request {
+	var (
+		entityKey string
+		tensor    = make([]float64, 0, len(row)-1)
+	)
+	for i, value := range row {
+		if i == 0 {
+			entityKey = value
+			continue
 		}
-
+		tensor = append(tensor, mapping.GetFeatureMapping(head[i], value))
+	}
+	return request{
+		EntityKey: entityKey,
+		Tensor:    tensor,
 	}
 }
 
-func writeResponseToFile(filePath string, records <-chan response) {
+// writeResponseToFile writes the scores to the output file until records is
+// closed or writing fails.
+func writeResponseToFile(filePath string, records <-chan response) error {
 	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("open output file: %w", err)
 	}
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
 
-	count := 0
 	for r := range records {
-		writer.Write([]string{r.EntityKey, cast.ToString(r.InferenceResponse)})
-		count++
-		if count%1000 == 0 {
-			log.Printf("%d record have been processed\n", count)
+		record := []string{r.EntityKey, cast.ToString(r.InferenceResponse)}
+		if candidate != nil {
+			// Rows the candidate failed to score keep an empty third column.
+			var score string
+			if r.Candidate != nil {
+				score = cast.ToString(*r.Candidate)
+				shadowScores.add(r.InferenceResponse, *r.Candidate)
+			}
+			record = append(record, score)
 		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("write %s: %w", filePath, err)
+		}
+		report.written()
+		tracker.done(1)
 	}
 
 	writer.Flush()
-
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("write %s: %w", filePath, err)
+	}
+	return file.Close()
 }
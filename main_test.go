@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+	"kfserving-inference-client/inferencetest"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+)
+
+func TestRequestChunkSplit(t *testing.T) {
+	chunk := NewRequestChunk()
+	for i, key := range []string{"a", "b", "c"} {
+		chunk.AddRecord(request{EntityKey: key, Tensor: []float64{float64(i), float64(i) + 0.5}})
+	}
+
+	left, right := chunk.Split()
+	assert.Equal(t, []string{"a"}, left.EntityKey)
+	assert.Equal(t, []float64{0, 0.5}, left.Tensor)
+	assert.Equal(t, []int64{1, 2}, left.Shape())
+	assert.Equal(t, []string{"b", "c"}, right.EntityKey)
+	assert.Equal(t, []float64{1, 1.5, 2, 2.5}, right.Tensor)
+	assert.Equal(t, []int64{2, 2}, right.Shape())
+
+	assert.Less(t, proto.Size(newInferRequest(left)), proto.Size(newInferRequest(chunk)))
+}
+
+func TestRequestWorkerDrainKeepsBatchSize(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	client := NewKFServingGrpcClient(1, append(s.DialOptions(), grpc.WithBlock(), grpc.WithTimeout(time.Second))...)
+	defer client.Close()
+	setFlags(t, map[string]string{"m": "model"})
+
+	oldLB, oldLimiter, oldConcurrency, oldSizer := lb, limiter, concurrency, sizer
+	defer func() { lb, limiter, concurrency, sizer = oldLB, oldLimiter, oldConcurrency, oldSizer }()
+	lb = newBalancer(client, []string{s.Addr})
+	limiter = newThrottle(0, 0, 3)
+	concurrency = newFixedConcurrency(1)
+	sizer = newFixedBatchSizer(3)
+
+	// The input is fully read before the worker starts, as when the reader
+	// finishes while workers are busy.
+	in := make(chan request, 10)
+	for i := 0; i < 10; i++ {
+		in <- request{EntityKey: "e", Tensor: []float64{1}}
+	}
+	close(in)
+
+	out := make(chan response, 10)
+	var wait sync.WaitGroup
+	wait.Add(1)
+	requestWorker(context.Background(), 0, &wait, in, out)
+
+	var rows int64
+	for _, c := range s.Calls("ModelInfer") {
+		shape := c.Request.(*inference.ModelInferRequest).Inputs[0].Shape
+		assert.LessOrEqual(t, shape[0], int64(3))
+		rows += shape[0]
+	}
+	assert.Equal(t, int64(10), rows)
+	assert.Len(t, s.Calls("ModelInfer"), 4)
+}
+
+func TestRequestWorkerDropsRowsWhenCancelled(t *testing.T) {
+	oldReport, oldSizer := report, sizer
+	defer func() { report, sizer = oldReport, oldSizer }()
+	report = newRunReport()
+	sizer = newFixedBatchSizer(3)
+
+	in := make(chan request, 10)
+	for i := 0; i < 5; i++ {
+		in <- request{EntityKey: "e", Tensor: []float64{1}}
+	}
+	close(in)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := make(chan response, 10)
+	var wait sync.WaitGroup
+	wait.Add(1)
+	requestWorker(ctx, 0, &wait, in, out)
+
+	assert.Empty(t, out)
+	assert.Equal(t, int64(5), report.Failed())
+}
+
+func TestScores(t *testing.T) {
+	raw := make([]byte, 16)
+	binary.LittleEndian.PutUint64(raw, math.Float64bits(1.5))
+	binary.LittleEndian.PutUint64(raw[8:], math.Float64bits(-2))
+
+	for name, c := range map[string]struct {
+		res  *inference.ModelInferResponse
+		want []float64
+	}{
+		"contents": {res: &inference.ModelInferResponse{Outputs: []*inference.ModelInferResponse_InferOutputTensor{
+			{Datatype: "FP64", Contents: &inference.InferTensorContents{Fp64Contents: []float64{1, 2}}},
+		}}, want: []float64{1, 2}},
+		"raw": {res: &inference.ModelInferResponse{
+			Outputs:           []*inference.ModelInferResponse_InferOutputTensor{{Datatype: "FP64"}},
+			RawOutputContents: [][]byte{raw},
+		}, want: []float64{1.5, -2}},
+		"no outputs":  {res: &inference.ModelInferResponse{}},
+		"no contents": {res: &inference.ModelInferResponse{Outputs: []*inference.ModelInferResponse_InferOutputTensor{{Datatype: "FP64"}}}},
+		"raw FP32": {res: &inference.ModelInferResponse{
+			Outputs:           []*inference.ModelInferResponse_InferOutputTensor{{Datatype: "FP32"}},
+			RawOutputContents: [][]byte{raw},
+		}},
+		"value per feature": {res: &inference.ModelInferResponse{Outputs: []*inference.ModelInferResponse_InferOutputTensor{
+			{Datatype: "FP64", Contents: &inference.InferTensorContents{Fp64Contents: []float64{1, 2, 3, 4}}},
+		}}},
+	} {
+		values, err := scores(c.res, 2)
+		if c.want == nil {
+			assert.Error(t, err, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		assert.Equal(t, c.want, values, name)
+	}
+}
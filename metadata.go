@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kfserving-inference-client/inference"
+)
+
+func init() {
+	var (
+		format    string
+		timeout   time.Duration
+		entityKey string
+	)
+	commands = append(commands, &command{
+		name:    "metadata",
+		summary: "Print server and model metadata, including the input and output tensors",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&format, "format", "table", "Output format: table, json or csv, the CSV header the batch processor expects")
+			fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of each call")
+			fs.StringVar(&entityKey, "entity-key", "entity_key", "Name of the entity key column in the -format csv header")
+		},
+		run: func([]string) error {
+			return runMetadata(format, timeout, entityKey)
+		},
+	})
+}
+
+type tensorJSON struct {
+	Name     string  `json:"name"`
+	Datatype string  `json:"datatype"`
+	Shape    []int64 `json:"shape"`
+}
+
+type serverMetadataJSON struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	Extensions []string `json:"extensions"`
+}
+
+type modelMetadataJSON struct {
+	Name     string       `json:"name"`
+	Versions []string     `json:"versions"`
+	Platform string       `json:"platform"`
+	Inputs   []tensorJSON `json:"inputs"`
+	Outputs  []tensorJSON `json:"outputs"`
+}
+
+type metadataJSON struct {
+	Server serverMetadataJSON `json:"server"`
+	Model  *modelMetadataJSON `json:"model,omitempty"`
+}
+
+func tensors(ts []*inference.ModelMetadataResponse_TensorMetadata) []tensorJSON {
+	out := make([]tensorJSON, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, tensorJSON{Name: t.Name, Datatype: t.Datatype, Shape: t.Shape})
+	}
+	return out
+}
+
+func newMetadataJSON(server *inference.ServerMetadataResponse, model *inference.ModelMetadataResponse) metadataJSON {
+	m := metadataJSON{
+		Server: serverMetadataJSON{
+			Name:       server.Name,
+			Version:    server.Version,
+			Extensions: server.Extensions,
+		},
+	}
+	if model != nil {
+		m.Model = &modelMetadataJSON{
+			Name:     model.Name,
+			Versions: model.Versions,
+			Platform: model.Platform,
+			Inputs:   tensors(model.Inputs),
+			Outputs:  tensors(model.Outputs),
+		}
+	}
+	return m
+}
+
+func runMetadata(format string, timeout time.Duration, entityKey string) error {
+	addrs, err := connect()
+	if err != nil {
+		return err
+	}
+	defer kfServingGrpcClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	server, err := kfServingGrpcClient.ServerMetadata(ctx, addrs[0])
+	if err != nil {
+		return fmt.Errorf("ServerMetadata: %w", err)
+	}
+
+	var model *inference.ModelMetadataResponse
+	if modelName != "" {
+		if model, err = kfServingGrpcClient.ModelMetadata(ctx, addrs[0], modelName, modelVersion); err != nil {
+			return fmt.Errorf("ModelMetadata: %w", err)
+		}
+	}
+
+	m := newMetadataJSON(server, model)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	case "table":
+		return printMetadata(os.Stdout, m)
+	case "csv":
+		if model == nil {
+			return fmt.Errorf("-format csv needs a model, set -m")
+		}
+		header, err := csvHeaderTemplate(model, entityKey)
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(os.Stdout)
+		w.Write(header)
+		w.Flush()
+		return w.Error()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func printMetadata(out io.Writer, m metadataJSON) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "SERVER\t%s\n", m.Server.Name)
+	fmt.Fprintf(w, "VERSION\t%s\n", m.Server.Version)
+	fmt.Fprintf(w, "EXTENSIONS\t%s\n", strings.Join(m.Server.Extensions, ", "))
+	if m.Model != nil {
+		fmt.Fprintf(w, "MODEL\t%s\n", m.Model.Name)
+		fmt.Fprintf(w, "VERSIONS\t%s\n", strings.Join(m.Model.Versions, ", "))
+		fmt.Fprintf(w, "PLATFORM\t%s\n", m.Model.Platform)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TENSOR\tNAME\tDATATYPE\tSHAPE")
+		for _, t := range m.Model.Inputs {
+			fmt.Fprintf(w, "input\t%s\t%s\t%v\n", t.Name, t.Datatype, t.Shape)
+		}
+		for _, t := range m.Model.Outputs {
+			fmt.Fprintf(w, "output\t%s\t%s\t%v\n", t.Name, t.Datatype, t.Shape)
+		}
+	}
+	return w.Flush()
+}
+
+// csvHeaderTemplate builds the header of an input file the batch processor
+// can send to model: the entity key followed by one column per feature of
+// the single [batch, features] input tensor. Feature names are placeholders
+// since the metadata does not carry them.
+func csvHeaderTemplate(model *inference.ModelMetadataResponse, entityKey string) ([]string, error) {
+	if len(model.Inputs) != 1 {
+		return nil, fmt.Errorf("model %s has %d inputs, the batch processor sends exactly one", model.Name, len(model.Inputs))
+	}
+
+	input := model.Inputs[0]
+	if len(input.Shape) != 2 || input.Shape[1] < 0 {
+		return nil, fmt.Errorf("input %s has shape %v, the number of features is unknown", input.Name, input.Shape)
+	}
+
+	header := []string{entityKey}
+	for i := int64(0); i < input.Shape[1]; i++ {
+		header = append(header, fmt.Sprintf("%s_%d", input.Name, i))
+	}
+	return header, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVHeaderTemplate(t *testing.T) {
+	model := &inference.ModelMetadataResponse{
+		Name: "simple",
+		Inputs: []*inference.ModelMetadataResponse_TensorMetadata{
+			{Name: "input-0", Datatype: "FP64", Shape: []int64{-1, 3}},
+		},
+	}
+	header, err := csvHeaderTemplate(model, "id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "input-0_0", "input-0_1", "input-0_2"}, header)
+
+	model.Inputs[0].Shape = []int64{-1, -1}
+	_, err = csvHeaderTemplate(model, "id")
+	assert.Error(t, err)
+}
+
+func TestPrintMetadata(t *testing.T) {
+	m := newMetadataJSON(
+		&inference.ServerMetadataResponse{Name: "mlserver", Version: "0.5.0", Extensions: []string{"model_repository"}},
+		&inference.ModelMetadataResponse{
+			Name:     "simple",
+			Versions: []string{"1"},
+			Platform: "lightgbm",
+			Inputs:   []*inference.ModelMetadataResponse_TensorMetadata{{Name: "input-0", Datatype: "FP64", Shape: []int64{-1, 28}}},
+			Outputs:  []*inference.ModelMetadataResponse_TensorMetadata{{Name: "predict", Datatype: "FP64", Shape: []int64{-1}}},
+		},
+	)
+
+	var out bytes.Buffer
+	assert.NoError(t, printMetadata(&out, m))
+	assert.Contains(t, out.String(), "EXTENSIONS  model_repository")
+	assert.Contains(t, out.String(), "input   input-0  FP64      [-1 28]")
+	assert.Contains(t, out.String(), "output  predict  FP64      [-1]")
+}
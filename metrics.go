@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "kfserving_inference_client"
+
+var (
+	rowsRead = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rows_read_total",
+		Help:      "Rows read from the input file.",
+	})
+	rowsScored = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rows_scored_total",
+		Help:      "Rows for which the model returned a prediction.",
+	})
+	rowsFailed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rows_failed_total",
+		Help:      "Rows whose inference request failed.",
+	})
+	retries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "ModelInfer calls retried after a retryable error.",
+	})
+	lastScored = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_scored_timestamp_seconds",
+		Help:      "Unix time of the last scored row, for alerting on stalled jobs.",
+	})
+	inFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "in_flight_requests",
+		Help:      "ModelInfer calls currently waiting for a response.",
+	})
+	concurrencyLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "concurrency_limit",
+		Help:      "Current bound on ModelInfer calls in flight.",
+	})
+	inferLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "model_infer_duration_seconds",
+		Help:      "Latency of ModelInfer calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	})
+	batchSizes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "batch_size_rows",
+		Help:      "Rows sent per ModelInfer call.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
+
+// serveMetrics exposes /metrics on addr. It never returns unless the
+// listener fails.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	logger.WithField("addr", addr).Info("serve metrics on /metrics")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.WithError(err).Error("metrics listener stopped")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetchModelConfig asks host for the model configuration. It returns nil
+// without error when the server does not implement the ModelConfig RPC, as
+// is the case for MLServer.
+func fetchModelConfig(client *KFServingGrpcClient, host, model, version string) (*inference.ModelConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	config, err := client.ModelConfig(ctx, host, model, version)
+	if status.Code(err) == codes.Unimplemented {
+		logger.WithField("host", host).Info("ModelConfig is not supported, skip model configuration checks")
+		return nil, nil
+	}
+	return config, err
+}
+
+// checkModelConfig validates the configuration of model on host against the
+// input file and returns its max_batch_size, 0 when unknown or unlimited.
+// Replicas behind a host list are assumed to serve the same configuration, so
+// only the first one is asked.
+func checkModelConfig(host, model, version, input string) (int64, error) {
+	logger.WithFields(logrus.Fields{"host": host, "model": model}).Info("check the model configuration of the first host")
+	config, err := fetchModelConfig(kfServingGrpcClient, host, model, version)
+	if err != nil {
+		logger.WithError(err).Warn("cannot fetch the model configuration, skip model configuration checks")
+		return 0, nil
+	}
+	if config == nil {
+		return 0, nil
+	}
+
+	features, err := inputFeatures(input)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateModelConfig(config, features); err != nil {
+		return 0, fmt.Errorf("model %s is incompatible with %s: %w", model, input, err)
+	}
+	return int64(config.MaxBatchSize), nil
+}
+
+// inputFeatures returns the number of feature columns of the CSV input, that
+// is every column but the entity key.
+func inputFeatures(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	head, err := csv.NewReader(file).Read()
+	if err != nil {
+		return 0, fmt.Errorf("read header of %s: %w", path, err)
+	}
+	return len(head) - 1, nil
+}
+
+func dimMatches(want, got int64) bool {
+	return want == -1 || want == got
+}
+
+// validateModelConfig checks that the single FP64 [batch, features] tensor
+// sent by the client, and the FP64 output it reads back, agree with config.
+func validateModelConfig(config *inference.ModelConfig, features int) error {
+	if len(config.Input) != 1 {
+		return fmt.Errorf("model %s expects %d inputs, the client sends exactly one", config.Name, len(config.Input))
+	}
+
+	input := config.Input[0]
+	if input.DataType != inference.DataType_TYPE_FP64 {
+		return fmt.Errorf("input %s has datatype %s, the client sends TYPE_FP64", input.Name, input.DataType)
+	}
+
+	// Dims leave out the batch dimension when the model supports batching.
+	// Otherwise it must be variable, as chunks vary in size.
+	dims := input.Dims
+	if config.MaxBatchSize == 0 {
+		if len(dims) != 2 || dims[0] != -1 {
+			return fmt.Errorf("input %s has dims %v, the client sends [-1, %d]", input.Name, dims, features)
+		}
+		dims = dims[1:]
+	}
+	if len(dims) != 1 || !dimMatches(dims[0], int64(features)) {
+		return fmt.Errorf("input %s has dims %v, the input file has %d features", input.Name, input.Dims, features)
+	}
+
+	if len(config.Output) > 0 && config.Output[0].DataType != inference.DataType_TYPE_FP64 {
+		return fmt.Errorf("output %s has datatype %s, the client reads TYPE_FP64", config.Output[0].Name, config.Output[0].DataType)
+	}
+	return nil
+}
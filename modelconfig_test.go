@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateModelConfig(t *testing.T) {
+	fp64 := inference.DataType_TYPE_FP64
+	config := func(maxBatch int32, dtype inference.DataType, dims ...int64) *inference.ModelConfig {
+		return &inference.ModelConfig{
+			Name:         "simple",
+			MaxBatchSize: maxBatch,
+			Input:        []*inference.ModelInput{{Name: "input-0", DataType: dtype, Dims: dims}},
+			Output:       []*inference.ModelOutput{{Name: "output-0", DataType: fp64}},
+		}
+	}
+
+	for _, c := range []struct {
+		config *inference.ModelConfig
+		ok     bool
+	}{
+		{config(100, fp64, 28), true},
+		{config(100, fp64, -1), true},
+		{config(0, fp64, -1, 28), true},
+		{config(0, fp64, 8, 28), false},
+		{config(100, fp64, 27), false},
+		{config(100, fp64, -1, 28), false},
+		{config(0, fp64, 28), false},
+		{config(100, inference.DataType_TYPE_FP32, 28), false},
+		{&inference.ModelConfig{Input: []*inference.ModelInput{{DataType: fp64, Dims: []int64{28}}, {DataType: fp64, Dims: []int64{1}}}, MaxBatchSize: 1}, false},
+		{&inference.ModelConfig{
+			MaxBatchSize: 1,
+			Input:        []*inference.ModelInput{{DataType: fp64, Dims: []int64{28}}},
+			Output:       []*inference.ModelOutput{{DataType: inference.DataType_TYPE_STRING}},
+		}, false},
+	} {
+		err := validateModelConfig(c.config, 28)
+		if c.ok {
+			assert.NoError(t, err, c.config.String())
+		} else {
+			assert.Error(t, err, c.config.String())
+		}
+	}
+}
+
+func TestInputFeatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte("id,a,b,city\n1,2,3,beijing\n"), 0644))
+
+	features, err := inputFeatures(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, features)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+	"kfserving-inference-client/inferencetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// setFlags sets batch processor flags for the duration of the test.
+func setFlags(t *testing.T, flags map[string]string) {
+	for name, value := range flags {
+		f := flag.CommandLine.Lookup(name)
+		require.NotNil(t, f, name)
+		old := f.Value.String()
+		require.NoError(t, f.Value.Set(value))
+		t.Cleanup(func() { f.Value.Set(old) })
+	}
+}
+
+// runPipeline scores rows of city,x against s with the batch processor and
+// returns the scores by entity key.
+func runPipeline(t *testing.T, s *inferencetest.Server, rows int, flags map[string]string) (map[string]string, error) {
+	dir := t.TempDir()
+	mappingDir := filepath.Join(dir, "mapping")
+	require.NoError(t, os.Mkdir(mappingDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(mappingDir, "city.csv"), []byte("value,mapping\nbeijing,1\nshanghai,2\n"), 0644))
+
+	input := []string{"entity_key,city,x"}
+	for i := 0; i < rows; i++ {
+		input = append(input, fmt.Sprintf("e%d,%s,%d", i, []string{"beijing", "shanghai"}[i%2], i))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "input.csv"), []byte(strings.Join(input, "\n")+"\n"), 0644))
+
+	setFlags(t, map[string]string{
+		"host":              s.Addr,
+		"m":                 "model",
+		"i":                 filepath.Join(dir, "input.csv"),
+		"o":                 filepath.Join(dir, "output.csv"),
+		"mapping_path":      mappingDir,
+		"progress-interval": "0",
+	})
+	setFlags(t, flags)
+	report, candidate, shadowScores = newRunReport(), nil, newComparison()
+	t.Cleanup(func() {
+		report, candidate, shadowScores = newRunReport(), nil, newComparison()
+	})
+
+	runErr := run()
+
+	file, err := os.Open(filepath.Join(dir, "output.csv"))
+	require.NoError(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+
+	scores := make(map[string]string)
+	for _, r := range records {
+		scores[r[0]] = strings.Join(r[1:], ",")
+	}
+	return scores, runErr
+}
+
+func TestPipeline(t *testing.T) {
+	s := inferencetest.NewServer(&inferencetest.Model{Features: 2})
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	scores, err := runPipeline(t, s, 10, map[string]string{"u": "3", "w": "2"})
+	require.NoError(t, err)
+
+	require.Len(t, scores, 10)
+	assert.Equal(t, "1", scores["e0"], "beijing maps to 1")
+	assert.Equal(t, "3", scores["e1"], "shanghai maps to 2")
+	assert.Equal(t, "11", scores["e9"])
+
+	var rows int64
+	for _, c := range s.Calls("ModelInfer") {
+		shape := c.Request.(*inference.ModelInferRequest).Inputs[0].Shape
+		assert.LessOrEqual(t, shape[0], int64(3))
+		rows += shape[0]
+	}
+	assert.Equal(t, int64(10), rows)
+}
+
+func TestPipelineRetriesAndFailures(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+	s.SetErrorRate(1, status.Error(codes.Unavailable, "down"))
+
+	scores, err := runPipeline(t, s, 4, map[string]string{"u": "2", "w": "1", "retries": "1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "4 rows failed")
+	assert.Empty(t, scores)
+	assert.Len(t, s.Calls("ModelInfer"), 4, "two chunks tried twice each")
+}
+
+// identity returns its input tensor, a value per feature instead of a score
+// per row.
+type identity struct{ inferencetest.Model }
+
+func (*identity) ModelInfer(_ context.Context, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	return &inference.ModelInferResponse{
+		ModelName: r.ModelName,
+		Outputs: []*inference.ModelInferResponse_InferOutputTensor{{
+			Name:     "output-0",
+			Datatype: "FP64",
+			Shape:    r.Inputs[0].Shape,
+			Contents: r.Inputs[0].Contents,
+		}},
+	}, nil
+}
+
+func TestPipelineFailsMalformedResponses(t *testing.T) {
+	s := inferencetest.NewServer(&identity{})
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	scores, err := runPipeline(t, s, 4, map[string]string{"u": "2", "w": "1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "4 rows failed")
+	assert.Empty(t, scores)
+	assert.Equal(t, map[string]int64{"Internal": 4}, report.JSON(time.Now(), nil).FailuresByCode)
+}
+
+func TestPipelineMalformedInput(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.csv")
+	require.NoError(t, ioutil.WriteFile(input, []byte("entity_key,x\ne0,1\ne1,2,3\ne2,3\n"), 0644))
+	reportPath := filepath.Join(dir, "report.json")
+
+	_, err := runPipeline(t, s, 0, map[string]string{"i": input, "report": reportPath})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "wrong number of fields")
+	assert.FileExists(t, reportPath, "the report is written before returning")
+}
+
+func TestPipelineSplitsLargeRequests(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	scores, err := runPipeline(t, s, 40, map[string]string{"u": "40", "w": "1", "max-send-msg-size": "300"})
+	require.NoError(t, err)
+	assert.Len(t, scores, 40)
+	assert.Greater(t, len(s.Calls("ModelInfer")), 1)
+}
+
+func TestPipelineCandidate(t *testing.T) {
+	primary := inferencetest.NewServer(nil)
+	require.NoError(t, primary.Start())
+	defer primary.Stop()
+	candidateServer := inferencetest.NewServer(&inferencetest.Model{
+		Name:    "model-v2",
+		Predict: func(row []float64) float64 { return 2 * inferencetest.Sum(row) },
+	})
+	require.NoError(t, candidateServer.Start())
+	defer candidateServer.Stop()
+
+	scores, err := runPipeline(t, primary, 10, map[string]string{
+		"u":                    "4",
+		"candidate-m":          "model-v2",
+		"candidate-host":       candidateServer.Addr,
+		"min-rank-correlation": "0.99",
+		"wait-ready":           "true",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "11,22", scores["e9"])
+	assert.Len(t, candidateServer.Calls("ModelInfer"), 3)
+
+	j := report.JSON(time.Now(), nil)
+	assert.Equal(t, 3, j.Requests, "candidate calls are not counted with the primary's")
+	s := j.Shadow
+	require.NotNil(t, s)
+	assert.Equal(t, 3, s.Requests)
+	assert.Greater(t, s.Latency.Max, float64(0))
+	assert.Equal(t, 10, s.Rows)
+	assert.InDelta(t, 1, s.RankCorrelation, 1e-9)
+	assert.InDelta(t, 0.5, s.MaxRelDiff, 1e-9)
+
+	_, err = runPipeline(t, primary, 10, map[string]string{
+		"candidate-m":       "model-v2",
+		"candidate-host":    candidateServer.Addr,
+		"max-mean-abs-diff": "0.1",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mean absolute difference")
+}
+
+func TestPipelineCandidateFailures(t *testing.T) {
+	primary := inferencetest.NewServer(nil)
+	require.NoError(t, primary.Start())
+	defer primary.Stop()
+	candidateServer := inferencetest.NewServer(nil)
+	require.NoError(t, candidateServer.Start())
+	defer candidateServer.Stop()
+	candidateServer.SetErrorRate(1, status.Error(codes.Internal, "broken"))
+
+	scores, err := runPipeline(t, primary, 10, map[string]string{
+		"u":              "4",
+		"candidate-host": candidateServer.Addr,
+	})
+	require.NoError(t, err, "candidate failures do not fail the run")
+	require.Len(t, scores, 10)
+	assert.Equal(t, "11,", scores["e9"], "keeps the primary score with an empty candidate column")
+
+	j := report.JSON(time.Now(), nil)
+	assert.Equal(t, int64(10), j.ScoredRows)
+	require.NotNil(t, j.Shadow)
+	assert.Equal(t, int64(10), j.Shadow.CandidateFailed)
+	assert.Zero(t, j.Shadow.Rows)
+
+	_, err = runPipeline(t, primary, 10, map[string]string{
+		"candidate-host":    candidateServer.Addr,
+		"max-mean-abs-diff": "0.1",
+	})
+	require.Error(t, err, "thresholds fail when nothing was compared")
+	assert.Contains(t, err.Error(), "no rows compared")
+}
+
+func TestPipelineDefaultMessageSizes(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	scores, err := runPipeline(t, s, 10, map[string]string{"u": "10", "w": "1", "max-send-msg-size": "0", "max-recv-msg-size": "0"})
+	require.NoError(t, err)
+	assert.Len(t, scores, 10)
+	assert.Len(t, s.Calls("ModelInfer"), 1)
+}
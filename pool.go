@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// connPool holds a fixed number of connections to a single host and hands
+// them out round-robin. Connections that have gone into TransientFailure or
+// Shutdown are closed and redialed the next time their slot is picked.
+type connPool struct {
+	host        string
+	dialOptions []grpc.DialOption
+
+	mutex  sync.Mutex
+	conns  []*grpc.ClientConn
+	next   uint32
+	closed bool
+}
+
+func newConnPool(host string, size int, dialOptions []grpc.DialOption) *connPool {
+	if size < 1 {
+		size = 1
+	}
+	return &connPool{
+		host:        host,
+		dialOptions: dialOptions,
+		conns:       make([]*grpc.ClientConn, size),
+	}
+}
+
+func (p *connPool) get(ctx context.Context) (*grpc.ClientConn, error) {
+	n := atomic.AddUint32(&p.next, 1) - 1
+	i := int(n % uint32(len(p.conns)))
+
+	p.mutex.Lock()
+	if conn := p.conns[i]; conn != nil {
+		if healthy(conn) {
+			p.mutex.Unlock()
+			return conn, nil
+		}
+		logger.WithFields(logrus.Fields{"host": p.host, "conn": i, "state": conn.GetState().String()}).Warn("evict connection")
+		conn.Close()
+		p.conns[i] = nil
+	}
+	p.mutex.Unlock()
+
+	// Dial without holding the lock, so that a slow or unreachable host
+	// does not stall callers picking the other slots. The dial gives up when
+	// ctx is done, before the dial timeout.
+	log := logger.WithFields(logrus.Fields{"host": p.host, "conn": i})
+	log.Debug("dial host")
+	conn, err := grpc.DialContext(ctx, p.host, p.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch {
+	case p.closed:
+		conn.Close()
+		return nil, fmt.Errorf("connection pool of %s is closed", p.host)
+	case p.conns[i] != nil:
+		// Another caller dialed the same slot in the meantime.
+		conn.Close()
+		return p.conns[i], nil
+	}
+	log.Info("dial host success")
+	p.conns[i] = conn
+	return conn, nil
+}
+
+func (p *connPool) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	for i, conn := range p.conns {
+		if conn != nil {
+			conn.Close()
+			p.conns[i] = nil
+		}
+	}
+}
+
+func healthy(conn *grpc.ClientConn) bool {
+	switch conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	}
+	return true
+}
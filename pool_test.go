@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"kfserving-inference-client/inferencetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+)
+
+func TestConnPoolIndexWraps(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	s.StartBufconn()
+	defer s.Stop()
+
+	p := newConnPool(s.Addr, 3, append(s.DialOptions(), grpc.WithBlock()))
+	defer p.close()
+	p.next = math.MaxUint32
+
+	for i := 0; i < 4; i++ {
+		_, err := p.get(context.Background())
+		require.NoError(t, err)
+	}
+}
+
+func TestConnPoolDialsOutsideLock(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	var (
+		dials   int32
+		dialing = make(chan struct{})
+		release = make(chan struct{})
+	)
+	options := []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		if atomic.AddInt32(&dials, 1) == 1 {
+			// The first slot hangs until released.
+			close(dialing)
+			<-release
+		}
+		return (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	})}
+	p := newConnPool(s.Addr, 2, options)
+	defer p.close()
+
+	done := make(chan error)
+	go func() {
+		_, err := p.get(context.Background())
+		done <- err
+	}()
+	<-dialing
+
+	_, err := p.get(context.Background())
+	assert.NoError(t, err, "the second slot is dialed while the first one hangs")
+
+	close(release)
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Input files up to this size are scanned once up front to count rows, larger
+// ones report progress by byte offset.
+const countRowsLimit = 256 << 20
+
+// progress tracks how far a run is and periodically reports percent done,
+// throughput, latency and ETA.
+type progress struct {
+	bytesRead  int64
+	totalBytes int64
+	totalRows  int64
+	rowsDone   int64
+
+	mutex   sync.Mutex
+	latency float64
+	start   time.Time
+}
+
+var tracker = &progress{start: time.Now()}
+
+// countingReader counts the bytes read through it into n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// countRows returns the number of data records of a CSV file with a header,
+// parsed the same way as the input so that quoted newlines and blank lines
+// are not miscounted.
+func countRows(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	csvr := csv.NewReader(file)
+	csvr.FieldsPerRecord = -1
+	csvr.ReuseRecord = true
+
+	var records int64
+	for {
+		_, err := csvr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		records++
+	}
+	if records > 0 {
+		records--
+	}
+	return records, nil
+}
+
+// input wraps the input file so that progress can follow the byte offset,
+// and counts its rows when the file is small enough.
+func (p *progress) input(file *os.File) io.Reader {
+	if info, err := file.Stat(); err == nil {
+		atomic.StoreInt64(&p.totalBytes, info.Size())
+		if info.Size() <= countRowsLimit {
+			if rows, err := countRows(file.Name()); err == nil {
+				atomic.StoreInt64(&p.totalRows, rows)
+			}
+		}
+	}
+	return countingReader{r: file, n: &p.bytesRead}
+}
+
+func (p *progress) done(rows int64) {
+	atomic.AddInt64(&p.rowsDone, rows)
+}
+
+// observeLatency folds d into an exponentially weighted moving average.
+func (p *progress) observeLatency(d time.Duration) {
+	const alpha = 0.1
+
+	p.mutex.Lock()
+	if p.latency == 0 {
+		p.latency = float64(d)
+	} else {
+		p.latency = alpha*float64(d) + (1-alpha)*p.latency
+	}
+	p.mutex.Unlock()
+}
+
+func (p *progress) fraction() float64 {
+	if total := atomic.LoadInt64(&p.totalRows); total > 0 {
+		return float64(atomic.LoadInt64(&p.rowsDone)) / float64(total)
+	}
+	if total := atomic.LoadInt64(&p.totalBytes); total > 0 {
+		return float64(atomic.LoadInt64(&p.bytesRead)) / float64(total)
+	}
+	return 0
+}
+
+type progressSnapshot struct {
+	Fraction   float64
+	Rows       int64
+	RowsPerSec float64
+	Latency    time.Duration
+	ETA        time.Duration
+}
+
+func (p *progress) snapshot(now time.Time, lastRows int64, lastTime time.Time) progressSnapshot {
+	s := progressSnapshot{
+		Fraction: p.fraction(),
+		Rows:     atomic.LoadInt64(&p.rowsDone),
+	}
+	if s.Fraction > 1 {
+		s.Fraction = 1
+	}
+
+	if elapsed := now.Sub(lastTime).Seconds(); elapsed > 0 {
+		s.RowsPerSec = float64(s.Rows-lastRows) / elapsed
+	}
+
+	p.mutex.Lock()
+	s.Latency = time.Duration(p.latency)
+	p.mutex.Unlock()
+
+	if s.Fraction > 0 {
+		elapsed := now.Sub(p.start)
+		s.ETA = time.Duration(float64(elapsed) * (1 - s.Fraction) / s.Fraction).Round(time.Second)
+	}
+	return s
+}
+
+func (s progressSnapshot) bar(width int) string {
+	filled := int(s.Fraction * float64(width))
+	return fmt.Sprintf("\r[%s%s] %5.1f%% %d rows %.0f rows/s latency %s ETA %s ",
+		strings.Repeat("#", filled), strings.Repeat(".", width-filled),
+		s.Fraction*100, s.Rows, s.RowsPerSec, s.Latency.Round(time.Millisecond), s.ETA)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// report prints progress every interval until ctx is done, as a progress bar
+// on a terminal and as log lines otherwise.
+func (p *progress) report(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	tty := isTerminal(os.Stderr)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		lastRows int64
+		lastTime = p.start
+	)
+	for {
+		select {
+		case now := <-ticker.C:
+			s := p.snapshot(now, lastRows, lastTime)
+			lastRows, lastTime = s.Rows, now
+
+			if tty {
+				fmt.Fprint(os.Stderr, s.bar(30))
+				continue
+			}
+			logger.WithFields(logrus.Fields{
+				"percent":      fmt.Sprintf("%.1f", s.Fraction*100),
+				"rows":         s.Rows,
+				"rows_per_sec": fmt.Sprintf("%.1f", s.RowsPerSec),
+				"latency":      s.Latency.Round(time.Millisecond).String(),
+				"eta":          s.ETA.String(),
+			}).Info("progress")
+		case <-ctx.Done():
+			if tty {
+				fmt.Fprintln(os.Stderr)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountRows(t *testing.T) {
+	dir := t.TempDir()
+	for content, rows := range map[string]int64{
+		"":                          0,
+		"id,f\n":                    0,
+		"id,f\n1,2\n3,4\n":          2,
+		"id,f\n1,2\n3,4":            2,
+		"id,f\n1,\"a\nb\"\n\n3,4\n": 2,
+	} {
+		path := filepath.Join(dir, "input.csv")
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+		n, err := countRows(path)
+		assert.NoError(t, err)
+		assert.Equal(t, rows, n, content)
+	}
+}
+
+func TestProgressSnapshot(t *testing.T) {
+	start := time.Now()
+	p := &progress{start: start, totalRows: 100}
+	p.done(25)
+	p.observeLatency(10 * time.Millisecond)
+
+	s := p.snapshot(start.Add(10*time.Second), 5, start.Add(5*time.Second))
+	assert.Equal(t, 0.25, s.Fraction)
+	assert.Equal(t, int64(25), s.Rows)
+	assert.Equal(t, float64(4), s.RowsPerSec)
+	assert.Equal(t, 10*time.Millisecond, s.Latency)
+	assert.Equal(t, 30*time.Second, s.ETA)
+
+	p = &progress{start: start, totalBytes: 1000, bytesRead: 500}
+	assert.Equal(t, 0.5, p.snapshot(start.Add(time.Second), 0, start).Fraction)
+}
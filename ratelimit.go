@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// throttle is a pair of token buckets shared by all workers, one limiting
+// ModelInfer calls per second and one limiting rows per second. A limit of 0
+// means unlimited.
+type throttle struct {
+	mutex      sync.Mutex
+	qps        float64
+	rowsPerSec float64
+	minBurst   int
+
+	requests *rate.Limiter
+	rows     *rate.Limiter
+}
+
+func toLimit(v float64) rate.Limit {
+	if v <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(v)
+}
+
+// burst lets a single call through even when the limit is below one per
+// second, and lets a whole batch through on the rows bucket.
+func burst(v float64, min int) int {
+	if b := int(v); b > min {
+		return b
+	}
+	return min
+}
+
+func newThrottle(qps, rowsPerSec float64, maxBatch int) *throttle {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	t := &throttle{
+		minBurst: maxBatch,
+		requests: rate.NewLimiter(toLimit(qps), burst(qps, 1)),
+		rows:     rate.NewLimiter(toLimit(rowsPerSec), burst(rowsPerSec, maxBatch)),
+	}
+	t.qps, t.rowsPerSec = qps, rowsPerSec
+	return t
+}
+
+func (t *throttle) Set(qps, rowsPerSec float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.qps, t.rowsPerSec = qps, rowsPerSec
+	t.requests.SetLimit(toLimit(qps))
+	t.requests.SetBurst(burst(qps, 1))
+	t.rows.SetLimit(toLimit(rowsPerSec))
+	t.rows.SetBurst(burst(rowsPerSec, t.minBurst))
+
+	logger.WithField("qps", qps).WithField("rows_per_sec", rowsPerSec).Info("update rate limits")
+}
+
+func (t *throttle) Get() (float64, float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.qps, t.rowsPerSec
+}
+
+// Wait blocks until one request carrying rows rows may be sent. Chunks larger
+// than the rows burst take their tokens a burst at a time.
+func (t *throttle) Wait(ctx context.Context, rows int) error {
+	if err := t.requests.Wait(ctx); err != nil {
+		return err
+	}
+
+	for rows > 0 {
+		n := rows
+		if b := t.rows.Burst(); n > b && t.rows.Limit() != rate.Inf {
+			n = b
+		}
+		if err := t.rows.WaitN(ctx, n); err != nil {
+			return err
+		}
+		rows -= n
+	}
+	return nil
+}
+
+type rateLimits struct {
+	QPS        float64 `json:"qps"`
+	RowsPerSec float64 `json:"rows_per_sec"`
+}
+
+// ServeHTTP reports the current limits on GET and changes them on POST or
+// PUT, e.g. curl -X POST 'localhost:9091/ratelimit?qps=50&rows_per_sec=2000'.
+// A parameter left out keeps its current value.
+func (t *throttle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		qps, rowsPerSec := t.Get()
+		for name, v := range map[string]*float64{"qps": &qps, "rows_per_sec": &rowsPerSec} {
+			s := r.URL.Query().Get(name)
+			if s == "" {
+				continue
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+				http.Error(w, "invalid "+name+": "+s, http.StatusBadRequest)
+				return
+			}
+			*v = f
+		}
+		t.Set(qps, rowsPerSec)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	qps, rowsPerSec := t.Get()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rateLimits{QPS: qps, RowsPerSec: rowsPerSec})
+}
+
+// serveAdmin exposes runtime controls on addr. It never returns unless the
+// listener fails.
+func serveAdmin(addr string, t *throttle) {
+	mux := http.NewServeMux()
+	mux.Handle("/ratelimit", t)
+
+	logger.WithField("addr", addr).Info("serve admin endpoint on /ratelimit")
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.WithError(err).Error("admin listener stopped")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The limiter fails a wait right away when it would outlast the context
+// deadline, which the tests use instead of measuring time.
+func TestThrottleWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	th := newThrottle(0, 0, 100)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, th.Wait(ctx, 100), "unlimited by default")
+	}
+
+	th = newThrottle(0, 1, 100)
+	require.NoError(t, th.Wait(ctx, 100), "a whole batch is within the burst")
+	assert.Error(t, th.Wait(ctx, 100), "the next batch would take 100s")
+
+	th = newThrottle(0, 20, 10)
+	require.NoError(t, th.Wait(ctx, 25), "chunks larger than the burst wait for it in pieces")
+	assert.Equal(t, 20, th.rows.Burst(), "the burst does not grow")
+
+	th.Set(1, 0)
+	require.NoError(t, th.Wait(ctx, 1))
+	short, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, th.Wait(short, 1), "second call would exceed one per second")
+}
+
+func TestThrottleAdmin(t *testing.T) {
+	th := newThrottle(10, 0, 100)
+	server := httptest.NewServer(th)
+	defer server.Close()
+
+	decode := func(res *http.Response) rateLimits {
+		defer res.Body.Close()
+		var l rateLimits
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&l))
+		return l
+	}
+
+	res, err := http.Get(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, rateLimits{QPS: 10}, decode(res))
+
+	res, err = http.Post(server.URL+"?rows_per_sec=500", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, rateLimits{QPS: 10, RowsPerSec: 500}, decode(res))
+
+	for _, query := range []string{"qps=abc", "qps=-1", "qps=NaN", "rows_per_sec=Inf", "rows_per_sec=-inf"} {
+		res, err = http.Post(server.URL+"?"+query, "", nil)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+	}
+	qps, rowsPerSec := th.Get()
+	assert.Equal(t, []float64{10, 500}, []float64{qps, rowsPerSec}, "invalid limits are not applied")
+}
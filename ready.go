@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readiness runs ServerLive, ServerReady and ModelReady against host in that
+// order and reports the first check that did not pass.
+func readiness(ctx context.Context, client *KFServingGrpcClient, host, model, version string) error {
+	checks := []struct {
+		name string
+		call func() (bool, error)
+	}{
+		{"ServerLive", func() (bool, error) { return client.ServerLive(ctx, host) }},
+		{"ServerReady", func() (bool, error) { return client.ServerReady(ctx, host) }},
+		{"ModelReady", func() (bool, error) { return client.ModelReady(ctx, host, model, version) }},
+	}
+
+	for _, c := range checks {
+		ok, err := c.call()
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", c.name, err)
+		}
+		if !ok {
+			return fmt.Errorf("%s returned false", c.name)
+		}
+	}
+	return nil
+}
+
+// waitReady polls readiness on every host until all of them pass or timeout
+// expires.
+func waitReady(client *KFServingGrpcClient, hosts []string, model, version string, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pending := append([]string(nil), hosts...)
+	for {
+		var failing []string
+		for _, h := range pending {
+			cctx, ccancel := context.WithTimeout(ctx, interval)
+			err := readiness(cctx, client, h, model, version)
+			ccancel()
+			if err != nil {
+				logger.WithField("host", h).WithError(err).Warn("host is not ready")
+				failing = append(failing, h)
+				continue
+			}
+			logger.WithFields(logrus.Fields{"host": h, "model": model, "version": version}).Info("host is ready")
+		}
+
+		if len(failing) == 0 {
+			return nil
+		}
+		pending = failing
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("hosts %v not ready after %s", pending, timeout)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	var (
+		repository string
+		readyOnly  bool
+		format     string
+		timeout    time.Duration
+	)
+	commands = append(commands, &command{
+		name:    "repo",
+		args:    " list | load <model> | unload <model>",
+		summary: "List the model repository, or load and unload a model on every host",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&repository, "repository", "", "Repository name, the server default when empty")
+			fs.BoolVar(&readyOnly, "ready-only", false, "List only the models that are ready")
+			fs.StringVar(&format, "format", "table", "Output format of list: table or json")
+			fs.DurationVar(&timeout, "timeout", 5*time.Minute, "Timeout of each call, loading a model can take a while")
+		},
+		run: func(args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("missing repo action: list, load or unload")
+			}
+
+			addrs, err := connect()
+			if err != nil {
+				return err
+			}
+			defer kfServingGrpcClient.Close()
+
+			switch action := args[0]; {
+			case action == "list" && len(args) == 1:
+				return listRepository(addrs, repository, readyOnly, format, timeout)
+			case action == "load" && len(args) == 2:
+				return loadModel(kfServingGrpcClient, addrs, repository, args[1], timeout)
+			case action == "unload" && len(args) == 2:
+				return unloadModel(kfServingGrpcClient, addrs, repository, args[1], timeout)
+			default:
+				return fmt.Errorf("invalid repo arguments %v", args)
+			}
+		},
+	})
+}
+
+type repositoryModel struct {
+	Host    string `json:"host"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	State   string `json:"state,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func listRepository(hosts []string, repository string, readyOnly bool, format string, timeout time.Duration) error {
+	var models []repositoryModel
+	for _, h := range hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		index, err := kfServingGrpcClient.RepositoryIndex(ctx, h, repository, readyOnly)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("RepositoryIndex on %s: %w", h, err)
+		}
+		for _, m := range index {
+			models = append(models, repositoryModel{Host: h, Name: m.Name, Version: m.Version, State: m.State, Reason: m.Reason})
+		}
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(models)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "HOST\tMODEL\tVERSION\tSTATE\tREASON")
+		for _, m := range models {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Host, m.Name, m.Version, m.State, m.Reason)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// loadModel loads name from the repository on every host.
+func loadModel(client *KFServingGrpcClient, hosts []string, repository, name string, timeout time.Duration) error {
+	for i, h := range hosts {
+		log := logger.WithFields(logrus.Fields{"host": h, "model": name})
+		log.Info("load model")
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := client.RepositoryModelLoad(ctx, h, repository, name)
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("load model %s on %s: %w", name, h, err)
+			if i > 0 {
+				log.WithError(err).Warn("unload the model from the hosts already loaded")
+				unloadModel(client, hosts[:i], repository, name, timeout)
+			}
+			return err
+		}
+		log.Info("model loaded")
+	}
+	return nil
+}
+
+// unloadModel unloads name on every host, trying all of them even if some
+// fail.
+func unloadModel(client *KFServingGrpcClient, hosts []string, repository, name string, timeout time.Duration) error {
+	var failed error
+	for _, h := range hosts {
+		log := logger.WithFields(logrus.Fields{"host": h, "model": name})
+		log.Info("unload model")
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := client.RepositoryModelUnload(ctx, h, repository, name)
+		cancel()
+		if err != nil {
+			log.WithError(err).Error("unload model failed")
+			failed = fmt.Errorf("unload model %s on %s: %w", name, h, err)
+			continue
+		}
+		log.Info("model unloaded")
+	}
+	return failed
+}
+
+// unloadAfterRun unloads model from hosts for -unload-after, logging failures
+// as the run is over by then.
+func unloadAfterRun(hosts []string, model string) {
+	if err := unloadModel(kfServingGrpcClient, hosts, repository, model, repositoryTimeout); err != nil {
+		logger.WithError(err).Error("cannot unload the model after the run")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type repoServer struct {
+	inference.UnimplementedGRPCInferenceServiceServer
+
+	mutex  sync.Mutex
+	loaded map[string]bool
+}
+
+func (s *repoServer) RepositoryIndex(_ context.Context, r *inference.RepositoryIndexRequest) (*inference.RepositoryIndexResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := &inference.RepositoryIndexResponse{}
+	for name, loaded := range s.loaded {
+		if r.Ready && !loaded {
+			continue
+		}
+		state := "UNAVAILABLE"
+		if loaded {
+			state = "READY"
+		}
+		res.Models = append(res.Models, &inference.RepositoryIndexResponse_ModelIndex{Name: name, Version: "1", State: state})
+	}
+	return res, nil
+}
+
+func (s *repoServer) RepositoryModelLoad(_ context.Context, r *inference.RepositoryModelLoadRequest) (*inference.RepositoryModelLoadResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.loaded[r.ModelName]; !ok {
+		return nil, status.Errorf(codes.NotFound, "model %s not found", r.ModelName)
+	}
+	s.loaded[r.ModelName] = true
+	return &inference.RepositoryModelLoadResponse{}, nil
+}
+
+func (s *repoServer) RepositoryModelUnload(_ context.Context, r *inference.RepositoryModelUnloadRequest) (*inference.RepositoryModelUnloadResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.loaded[r.ModelName] = false
+	return &inference.RepositoryModelUnloadResponse{}, nil
+}
+
+func TestLoadUnloadModel(t *testing.T) {
+	var hosts []string
+	var servers []*repoServer
+	for i := 0; i < 2; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		rs := &repoServer{loaded: map[string]bool{"simple": false}}
+		if i == 0 {
+			rs.loaded["partial"] = false
+		}
+		s := grpc.NewServer()
+		inference.RegisterGRPCInferenceServiceServer(s, rs)
+		go s.Serve(lis)
+		defer s.Stop()
+
+		hosts = append(hosts, lis.Addr().String())
+		servers = append(servers, rs)
+	}
+
+	client := NewKFServingGrpcClient(1, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	defer client.Close()
+
+	require.NoError(t, loadModel(client, hosts, "", "simple", time.Second))
+	for _, rs := range servers {
+		assert.True(t, rs.loaded["simple"])
+	}
+
+	index, err := client.RepositoryIndex(context.Background(), hosts[0], "", true)
+	require.NoError(t, err)
+	require.Len(t, index, 1)
+	assert.Equal(t, "READY", index[0].State)
+
+	require.NoError(t, unloadModel(client, hosts, "", "simple", time.Second))
+	for _, rs := range servers {
+		assert.False(t, rs.loaded["simple"])
+	}
+
+	err = loadModel(client, hosts, "", "missing", time.Second)
+	assert.Contains(t, err.Error(), "not found")
+
+	err = loadModel(client, hosts, "", "partial", time.Second)
+	assert.Contains(t, err.Error(), "not found")
+	assert.False(t, servers[0].loaded["partial"], "unloaded from the host it was loaded on")
+}
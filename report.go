@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// runReport accumulates what happened during a batch run and is written as
+// JSON at the end so that workflows can gate later steps on it.
+type runReport struct {
+	mutex sync.Mutex
+
+	start     time.Time
+	rowsRead  int64
+	rowsOut   int64
+	scored    int64
+	failed    int64
+	failures  map[string]int64
+	latencies *latencyReservoir
+	models    map[string]bool
+	server    *serverStats
+	shadow    *shadowSummary
+}
+
+type latencySummary struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+type reportModel struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type reportJSON struct {
+	StartTime       time.Time         `json:"start_time"`
+	EndTime         time.Time         `json:"end_time"`
+	DurationSeconds float64           `json:"duration_seconds"`
+	InputRows       int64             `json:"input_rows"`
+	OutputRows      int64             `json:"output_rows"`
+	ScoredRows      int64             `json:"scored_rows"`
+	FailedRows      int64             `json:"failed_rows"`
+	FailuresByCode  map[string]int64  `json:"failures_by_code"`
+	RowsPerSecond   float64           `json:"rows_per_second"`
+	Requests        int               `json:"requests"`
+	Latency         latencySummary    `json:"latency"`
+	Models          []reportModel     `json:"models"`
+	ServerStats     *serverStatsJSON  `json:"server_statistics,omitempty"`
+	Shadow          *shadowSummary    `json:"candidate_comparison,omitempty"`
+	Config          map[string]string `json:"config"`
+}
+
+// latencySamples bounds the latencies kept for percentiles. Past it they are
+// a uniform reservoir sample of every request, so percentiles are estimates
+// while the request count and maximum stay exact.
+const latencySamples = 10000
+
+// latencyReservoir summarizes request latencies in bounded memory. It is not
+// safe for concurrent use.
+type latencyReservoir struct {
+	requests int
+	slowest  time.Duration
+	samples  []time.Duration
+	rand     *rand.Rand
+}
+
+func newLatencyReservoir() *latencyReservoir {
+	return &latencyReservoir{rand: rand.New(rand.NewSource(1))}
+}
+
+func (l *latencyReservoir) add(d time.Duration) {
+	l.requests++
+	if d > l.slowest {
+		l.slowest = d
+	}
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, d)
+	} else if i := l.rand.Intn(l.requests); i < latencySamples {
+		l.samples[i] = d
+	}
+}
+
+func (l *latencyReservoir) summary() latencySummary {
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return latencySummary{
+		P50: percentile(sorted, 0.50),
+		P90: percentile(sorted, 0.90),
+		P99: percentile(sorted, 0.99),
+		Max: float64(l.slowest) / float64(time.Millisecond),
+	}
+}
+
+var report = newRunReport()
+
+func newRunReport() *runReport {
+	return &runReport{
+		start:     time.Now(),
+		failures:  make(map[string]int64),
+		latencies: newLatencyReservoir(),
+		models:    make(map[string]bool),
+	}
+}
+
+func (r *runReport) read() {
+	r.mutex.Lock()
+	r.rowsRead++
+	r.mutex.Unlock()
+}
+
+func (r *runReport) written() {
+	r.mutex.Lock()
+	r.rowsOut++
+	r.mutex.Unlock()
+}
+
+func (r *runReport) latency(d time.Duration) {
+	r.mutex.Lock()
+	r.latencies.add(d)
+	r.mutex.Unlock()
+}
+
+func (r *runReport) success(rows int64, model, version string) {
+	r.mutex.Lock()
+	r.scored += rows
+	r.models[model+"\x00"+version] = true
+	r.mutex.Unlock()
+}
+
+func (r *runReport) failure(rows int64, err error) {
+	r.mutex.Lock()
+	r.failed += rows
+	r.failures[status.Code(err).String()] += rows
+	r.mutex.Unlock()
+}
+
+// serverDelta records the server-side statistics accumulated during the run.
+func (r *runReport) serverDelta(before, after *serverStats) {
+	if before == nil || after == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.server = after.sub(before)
+	r.mutex.Unlock()
+}
+
+func (r *runReport) shadowSummary(s shadowSummary) {
+	r.mutex.Lock()
+	r.shadow = &s
+	r.mutex.Unlock()
+}
+
+func (r *runReport) Failed() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.failed
+}
+
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return float64(sorted[i]) / float64(time.Millisecond)
+}
+
+// secretFlags may carry credentials and are redacted from the report.
+var secretFlags = map[string]bool{"token": true, "header": true}
+
+// effectiveConfig returns every flag value, with secrets redacted.
+func effectiveConfig(fs *flag.FlagSet) map[string]string {
+	config := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if value != "" && secretFlags[f.Name] {
+			value = "REDACTED"
+		}
+		config[f.Name] = value
+	})
+	return config
+}
+
+func (r *runReport) JSON(end time.Time, config map[string]string) reportJSON {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var models []reportModel
+	for k := range r.models {
+		nv := strings.SplitN(k, "\x00", 2)
+		models = append(models, reportModel{Name: nv[0], Version: nv[1]})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name+models[i].Version < models[j].Name+models[j].Version
+	})
+
+	duration := end.Sub(r.start).Seconds()
+	var throughput float64
+	if duration > 0 {
+		throughput = float64(r.scored) / duration
+	}
+
+	var server *serverStatsJSON
+	if r.server != nil {
+		server = r.server.JSON()
+	}
+
+	return reportJSON{
+		StartTime:       r.start,
+		EndTime:         end,
+		DurationSeconds: duration,
+		InputRows:       r.rowsRead,
+		OutputRows:      r.rowsOut,
+		ScoredRows:      r.scored,
+		FailedRows:      r.failed,
+		FailuresByCode:  r.failures,
+		RowsPerSecond:   throughput,
+		Requests:        r.latencies.requests,
+		Latency:         r.latencies.summary(),
+		Models:          models,
+		ServerStats:     server,
+		Shadow:          r.shadow,
+		Config:          config,
+	}
+}
+
+func (r *runReport) WriteFile(path string, config map[string]string) error {
+	b, err := json.MarshalIndent(r.JSON(time.Now(), config), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
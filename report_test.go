@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunReport(t *testing.T) {
+	r := newRunReport()
+	for i := 1; i <= 100; i++ {
+		r.latency(time.Duration(i) * time.Millisecond)
+	}
+	r.success(10, "simple", "2")
+	r.success(5, "simple", "2")
+	r.failure(3, status.Error(codes.Unavailable, "down"))
+	r.failure(2, errors.New("boom"))
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("token", "secret", "")
+	fs.String("m", "simple", "")
+
+	j := r.JSON(r.start.Add(time.Second), effectiveConfig(fs))
+	assert.Equal(t, int64(15), j.ScoredRows)
+	assert.Equal(t, int64(5), j.FailedRows)
+	assert.Equal(t, map[string]int64{"Unavailable": 3, "Unknown": 2}, j.FailuresByCode)
+	assert.Equal(t, float64(15), j.RowsPerSecond)
+	assert.Equal(t, 100, j.Requests)
+	assert.Equal(t, latencySummary{P50: 50, P90: 90, P99: 99, Max: 100}, j.Latency)
+	assert.Equal(t, []reportModel{{Name: "simple", Version: "2"}}, j.Models)
+	assert.Equal(t, map[string]string{"token": "REDACTED", "m": "simple"}, j.Config)
+}
+
+func TestRunReportBoundsLatencies(t *testing.T) {
+	r := newRunReport()
+	// Latencies increase from 1µs to 100ms.
+	n := 10 * latencySamples
+	for i := 1; i <= n; i++ {
+		r.latency(time.Duration(i) * 100 * time.Millisecond / time.Duration(n))
+	}
+	assert.Len(t, r.latencies.samples, latencySamples)
+
+	j := r.JSON(r.start.Add(time.Second), nil)
+	assert.Equal(t, n, j.Requests)
+	assert.Equal(t, float64(100), j.Latency.Max)
+	assert.InDelta(t, 50, j.Latency.P50, 5)
+	assert.InDelta(t, 99, j.Latency.P99, 2)
+}
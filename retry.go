@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// requestRows returns the batch size of r, the rows the rate limit counts.
+func requestRows(r *inference.ModelInferRequest) int {
+	if len(r.Inputs) > 0 && len(r.Inputs[0].Shape) > 0 {
+		return int(r.Inputs[0].Shape[0])
+	}
+	return 0
+}
+
+// inferWithRetry calls ModelInfer through b, retrying retryable errors up to
+// maxRetries times with exponential backoff. It also returns how long the last
+// call took, leaving out waits for rate limits, concurrency and backoff.
+func inferWithRetry(ctx context.Context, b *balancer, r *inference.ModelInferRequest) (*inference.ModelInferResponse, time.Duration, error) {
+	rows := requestRows(r)
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		// Take the slot first, so that rate tokens are not spent by calls
+		// still waiting for one.
+		if err := concurrency.Acquire(ctx); err != nil {
+			return nil, 0, err
+		}
+		if err := limiter.Wait(ctx, rows); err != nil {
+			concurrency.Release(0, err)
+			return nil, 0, err
+		}
+
+		actx, span := tracer.Start(ctx, "ModelInfer", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+		inFlight.Inc()
+		start := time.Now()
+		res, err := b.Inference(injectTraceContext(actx), r)
+		elapsed := time.Since(start)
+		inferLatency.Observe(elapsed.Seconds())
+		report.latency(elapsed)
+		tracker.observeLatency(elapsed)
+		inFlight.Dec()
+		concurrency.Release(elapsed, err)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, status.Code(err).String())
+		}
+		span.End()
+
+		if err == nil || attempt >= maxRetries || !retryable(err) {
+			return res, elapsed, err
+		}
+
+		loggerFrom(ctx).WithFields(logrus.Fields{"attempt": attempt + 1, "backoff": backoff.String()}).WithError(err).Info("retry ModelInfer")
+		retries.Inc()
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/sirupsen/logrus"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	var (
+		grpcAddr string
+		httpAddr string
+		models   = modelFlags{}
+	)
+	commands = append(commands, &command{
+		name:    "serve",
+		summary: "Serve built-in models over the V2 gRPC and REST protocols for local development",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&grpcAddr, "grpc-addr", ":8001", "Address of the gRPC endpoint")
+			fs.StringVar(&httpAddr, "http-addr", ":8080", "Address of the REST endpoint, disabled when empty")
+			fs.Var(&models, "model", "Model to serve as name=kind, repeatable. Kinds are linear:<coefficients.json>, logistic:<coefficients.json>, identity and constant:<value>")
+		},
+		run: func([]string) error {
+			if len(models) == 0 {
+				return fmt.Errorf("no model to serve, set -model")
+			}
+			return runServe(grpcAddr, httpAddr, newLocalServer(models))
+		},
+	})
+}
+
+// localModel is a built-in model scoring FP64 [batch, features] tensors.
+type localModel struct {
+	name     string
+	kind     string
+	features int64 // -1 for any number
+	outputs  int64 // -1 for as many as features
+	predict  func(row []float64) []float64
+	ready    bool
+}
+
+// coefficients is the file format of linear and logistic models.
+type coefficients struct {
+	Intercept    float64   `json:"intercept"`
+	Coefficients []float64 `json:"coefficients"`
+}
+
+func (c coefficients) linear(row []float64) float64 {
+	y := c.Intercept
+	for i, x := range row {
+		y += c.Coefficients[i] * x
+	}
+	return y
+}
+
+func readCoefficients(path string) (coefficients, error) {
+	var c coefficients
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(c.Coefficients) == 0 {
+		return c, fmt.Errorf("no coefficients in %s", path)
+	}
+	return c, nil
+}
+
+// newLocalModel builds a model from its -model spec, kind[:argument].
+func newLocalModel(name, spec string) (*localModel, error) {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	m := &localModel{name: name, kind: kind, features: -1, outputs: 1, ready: true}
+	switch kind {
+	case "linear", "logistic":
+		c, err := readCoefficients(arg)
+		if err != nil {
+			return nil, err
+		}
+		m.features = int64(len(c.Coefficients))
+		if kind == "linear" {
+			m.predict = func(row []float64) []float64 { return []float64{c.linear(row)} }
+		} else {
+			m.predict = func(row []float64) []float64 { return []float64{1 / (1 + math.Exp(-c.linear(row)))} }
+		}
+	case "identity":
+		m.outputs = -1
+		m.predict = func(row []float64) []float64 { return row }
+	case "constant":
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid constant %q", arg)
+		}
+		m.predict = func([]float64) []float64 { return []float64{v} }
+	default:
+		return nil, fmt.Errorf("unknown model kind %q", kind)
+	}
+	return m, nil
+}
+
+// modelFlags collects repeated -model name=kind flags.
+type modelFlags map[string]string
+
+func (m modelFlags) String() string {
+	specs := make([]string, 0, len(m))
+	for name, spec := range m {
+		specs = append(specs, name+"="+spec)
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (m modelFlags) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("invalid model %q, expected name=kind", s)
+	}
+	m[s[:i]] = s[i+1:]
+	return nil
+}
+
+// localServer implements the V2 inference protocol for built-in models. All
+// of them share version "1".
+type localServer struct {
+	inference.UnimplementedGRPCInferenceServiceServer
+
+	mutex  sync.Mutex
+	models map[string]*localModel
+	specs  modelFlags
+}
+
+func newLocalServer(specs modelFlags) *localServer {
+	return &localServer{models: make(map[string]*localModel), specs: specs}
+}
+
+// load builds every model, so that a bad coefficient file fails at startup.
+func (s *localServer) load() error {
+	for name := range s.specs {
+		if _, err := s.RepositoryModelLoad(context.Background(), &inference.RepositoryModelLoadRequest{ModelName: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *localServer) model(name, version string) (*localModel, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	m, ok := s.models[name]
+	if !ok || (version != "" && version != "1") {
+		return nil, status.Errorf(codes.NotFound, "model %s version %q not found", name, version)
+	}
+	return m, nil
+}
+
+func (s *localServer) ServerLive(context.Context, *inference.ServerLiveRequest) (*inference.ServerLiveResponse, error) {
+	return &inference.ServerLiveResponse{Live: true}, nil
+}
+
+// ServerReady reports whether every model is loaded and ready.
+func (s *localServer) ServerReady(context.Context, *inference.ServerReadyRequest) (*inference.ServerReadyResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for name := range s.specs {
+		if m, ok := s.models[name]; !ok || !m.ready {
+			return &inference.ServerReadyResponse{Ready: false}, nil
+		}
+	}
+	return &inference.ServerReadyResponse{Ready: true}, nil
+}
+
+func (s *localServer) ModelReady(_ context.Context, r *inference.ModelReadyRequest) (*inference.ModelReadyResponse, error) {
+	m, err := s.model(r.Name, r.Version)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return &inference.ModelReadyResponse{Ready: m.ready}, nil
+}
+
+func (s *localServer) ServerMetadata(context.Context, *inference.ServerMetadataRequest) (*inference.ServerMetadataResponse, error) {
+	return &inference.ServerMetadataResponse{
+		Name:       "kfserving-inference-client",
+		Version:    "1",
+		Extensions: []string{"model_repository"},
+	}, nil
+}
+
+func (s *localServer) ModelMetadata(_ context.Context, r *inference.ModelMetadataRequest) (*inference.ModelMetadataResponse, error) {
+	m, err := s.model(r.Name, r.Version)
+	if err != nil {
+		return nil, err
+	}
+	outputs := m.outputs
+	if outputs < 0 {
+		outputs = m.features
+	}
+	return &inference.ModelMetadataResponse{
+		Name:     m.name,
+		Versions: []string{"1"},
+		Platform: m.kind,
+		Inputs:   []*inference.ModelMetadataResponse_TensorMetadata{{Name: "input-0", Datatype: "FP64", Shape: []int64{-1, m.features}}},
+		Outputs:  []*inference.ModelMetadataResponse_TensorMetadata{{Name: "output-0", Datatype: "FP64", Shape: []int64{-1, outputs}}},
+	}, nil
+}
+
+func (s *localServer) ModelInfer(_ context.Context, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	m, err := s.model(r.ModelName, r.ModelVersion)
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	ready := m.ready
+	s.mutex.Unlock()
+	if !ready {
+		return nil, status.Errorf(codes.Unavailable, "model %s is not loaded", m.name)
+	}
+
+	if len(r.Inputs) != 1 || r.Inputs[0].Datatype != "FP64" || len(r.Inputs[0].Shape) != 2 || r.Inputs[0].Contents == nil {
+		return nil, status.Error(codes.InvalidArgument, "expected a single FP64 [batch, features] input")
+	}
+	rows, features := r.Inputs[0].Shape[0], r.Inputs[0].Shape[1]
+	tensor := r.Inputs[0].Contents.Fp64Contents
+	// Checked by division, as rows*features may overflow.
+	if features <= 0 || rows < 0 || int64(len(tensor))%features != 0 || int64(len(tensor))/features != rows {
+		return nil, status.Errorf(codes.InvalidArgument, "input has %d values for shape %v", len(tensor), r.Inputs[0].Shape)
+	}
+	if m.features >= 0 && features != m.features {
+		return nil, status.Errorf(codes.InvalidArgument, "model %s takes %d features, got %d", m.name, m.features, features)
+	}
+
+	var scores []float64
+	for i := int64(0); i < rows; i++ {
+		scores = append(scores, m.predict(tensor[i*features:(i+1)*features])...)
+	}
+	var outputs int64
+	if rows > 0 {
+		outputs = int64(len(scores)) / rows
+	}
+
+	return &inference.ModelInferResponse{
+		ModelName:    m.name,
+		ModelVersion: "1",
+		Id:           r.Id,
+		Outputs: []*inference.ModelInferResponse_InferOutputTensor{{
+			Name:     "output-0",
+			Datatype: "FP64",
+			Shape:    []int64{rows, outputs},
+			Contents: &inference.InferTensorContents{Fp64Contents: scores},
+		}},
+	}, nil
+}
+
+func (s *localServer) RepositoryIndex(_ context.Context, r *inference.RepositoryIndexRequest) (*inference.RepositoryIndexResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	names := make([]string, 0, len(s.specs))
+	for name := range s.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := &inference.RepositoryIndexResponse{}
+	for _, name := range names {
+		m, ok := s.models[name]
+		ready := ok && m.ready
+		if r.Ready && !ready {
+			continue
+		}
+		index := &inference.RepositoryIndexResponse_ModelIndex{Name: name, Version: "1", State: "READY"}
+		switch {
+		case !ok:
+			index.State, index.Reason = "UNAVAILABLE", "not loaded"
+		case !ready:
+			index.State, index.Reason = "UNAVAILABLE", "unloaded"
+		}
+		res.Models = append(res.Models, index)
+	}
+	return res, nil
+}
+
+func (s *localServer) RepositoryModelLoad(_ context.Context, r *inference.RepositoryModelLoadRequest) (*inference.RepositoryModelLoadResponse, error) {
+	spec, ok := s.specs[r.ModelName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "model %s not found", r.ModelName)
+	}
+	// Reloading picks up changes to the coefficient file.
+	m, err := newLocalModel(r.ModelName, spec)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "load model %s: %v", r.ModelName, err)
+	}
+
+	s.mutex.Lock()
+	s.models[r.ModelName] = m
+	s.mutex.Unlock()
+	logger.WithFields(logrus.Fields{"model": m.name, "kind": m.kind}).Info("model loaded")
+	return &inference.RepositoryModelLoadResponse{}, nil
+}
+
+func (s *localServer) RepositoryModelUnload(_ context.Context, r *inference.RepositoryModelUnloadRequest) (*inference.RepositoryModelUnloadResponse, error) {
+	m, err := s.model(r.ModelName, "")
+	if err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	m.ready = false
+	s.mutex.Unlock()
+	logger.WithField("model", m.name).Info("model unloaded")
+	return &inference.RepositoryModelUnloadResponse{}, nil
+}
+
+// runServe serves s until interrupted.
+func runServe(grpcAddr, httpAddr string, s *localServer) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	inference.RegisterGRPCInferenceServiceServer(server, s)
+
+	var httpServer *http.Server
+	if httpAddr != "" {
+		httpServer = &http.Server{Addr: httpAddr, Handler: restHandler(s)}
+		go func() {
+			logger.WithField("addr", httpAddr).Info("serve REST endpoint")
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				logger.WithError(err).Error("REST listener stopped")
+			}
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		logger.Info("shut down")
+		if httpServer != nil {
+			httpServer.Shutdown(context.Background())
+		}
+		server.GracefulStop()
+	}()
+
+	logger.WithField("addr", lis.Addr().String()).Info("serve gRPC endpoint")
+	return server.Serve(lis)
+}
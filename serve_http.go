@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"kfserving-inference-client/inference"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type restTensor struct {
+	Name     string    `json:"name"`
+	Shape    []int64   `json:"shape"`
+	Datatype string    `json:"datatype"`
+	Data     []float64 `json:"data"`
+}
+
+type restInferRequest struct {
+	ID     string       `json:"id,omitempty"`
+	Inputs []restTensor `json:"inputs"`
+}
+
+type restInferResponse struct {
+	ModelName    string       `json:"model_name"`
+	ModelVersion string       `json:"model_version"`
+	ID           string       `json:"id,omitempty"`
+	Outputs      []restTensor `json:"outputs"`
+}
+
+// UnmarshalJSON accepts the tensor data flat or nested by shape, as the V2
+// protocol allows both.
+func (t *restTensor) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Name     string      `json:"name"`
+		Shape    []int64     `json:"shape"`
+		Datatype string      `json:"datatype"`
+		Data     interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	t.Name, t.Shape, t.Datatype = raw.Name, raw.Shape, raw.Datatype
+
+	var flatten func(v interface{}) error
+	flatten = func(v interface{}) error {
+		switch v := v.(type) {
+		case float64:
+			t.Data = append(t.Data, v)
+		case []interface{}:
+			for _, e := range v {
+				if err := flatten(e); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("tensor %s has non-numeric data", t.Name)
+		}
+		return nil
+	}
+	return flatten(raw.Data)
+}
+
+var httpStatus = map[codes.Code]int{
+	codes.NotFound:         http.StatusNotFound,
+	codes.InvalidArgument:  http.StatusBadRequest,
+	codes.Unavailable:      http.StatusServiceUnavailable,
+	codes.Unimplemented:    http.StatusNotImplemented,
+	codes.DeadlineExceeded: http.StatusGatewayTimeout,
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code, ok := httpStatus[status.Code(err)]
+		if !ok {
+			code = http.StatusInternalServerError
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": status.Convert(err).Message()})
+		return
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+// restHandler serves the V2 REST protocol on top of the gRPC implementation,
+// under /v2.
+func restHandler(s *localServer) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v2/health/live", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/v2/health/ready", func(w http.ResponseWriter, r *http.Request) {
+		res, err := s.ServerReady(r.Context(), &inference.ServerReadyRequest{})
+		if err != nil || !res.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/v2", func(w http.ResponseWriter, r *http.Request) {
+		res, err := s.ServerMetadata(r.Context(), &inference.ServerMetadataRequest{})
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		writeJSON(w, newMetadataJSON(res, nil).Server, nil)
+	})
+	mux.HandleFunc("/v2/repository/index", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ready bool `json:"ready"`
+		}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&req)
+		}
+		res, err := s.RepositoryIndex(r.Context(), &inference.RepositoryIndexRequest{Ready: req.Ready})
+		if err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		index := make([]map[string]string, 0, len(res.Models))
+		for _, m := range res.Models {
+			model := map[string]string{"name": m.Name, "version": m.Version, "state": m.State}
+			if m.Reason != "" {
+				model["reason"] = m.Reason
+			}
+			index = append(index, model)
+		}
+		writeJSON(w, index, nil)
+	})
+	mux.HandleFunc("/v2/repository/models/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/repository/models/"), "/")
+		if len(parts) != 2 || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		var err error
+		switch parts[1] {
+		case "load":
+			_, err = s.RepositoryModelLoad(r.Context(), &inference.RepositoryModelLoadRequest{ModelName: parts[0]})
+		case "unload":
+			_, err = s.RepositoryModelUnload(r.Context(), &inference.RepositoryModelUnloadRequest{ModelName: parts[0]})
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, struct{}{}, err)
+	})
+	mux.HandleFunc("/v2/models/", func(w http.ResponseWriter, r *http.Request) {
+		// /v2/models/{name}[/versions/{version}][/ready|/infer]
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/models/"), "/")
+		name, version, action := parts[0], "", ""
+		if len(parts) >= 3 && parts[1] == "versions" {
+			version, parts = parts[2], append(parts[:1], parts[3:]...)
+		}
+		switch len(parts) {
+		case 1:
+		case 2:
+			action = parts[1]
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		switch action {
+		case "":
+			res, err := s.ModelMetadata(r.Context(), &inference.ModelMetadataRequest{Name: name, Version: version})
+			if err != nil {
+				writeJSON(w, nil, err)
+				return
+			}
+			writeJSON(w, newMetadataJSON(&inference.ServerMetadataResponse{}, res).Model, nil)
+		case "ready":
+			res, err := s.ModelReady(r.Context(), &inference.ModelReadyRequest{Name: name, Version: version})
+			if err == nil && !res.Ready {
+				err = status.Errorf(codes.Unavailable, "model %s is not ready", name)
+			}
+			writeJSON(w, struct{}{}, err)
+		case "infer":
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			var req restInferRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSON(w, nil, status.Errorf(codes.InvalidArgument, "parse request: %v", err))
+				return
+			}
+			res, err := restInfer(r.Context(), s, name, version, req)
+			writeJSON(w, res, err)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return mux
+}
+
+func restInfer(ctx context.Context, s *localServer, name, version string, req restInferRequest) (*restInferResponse, error) {
+	grpcReq := &inference.ModelInferRequest{ModelName: name, ModelVersion: version, Id: req.ID}
+	for _, t := range req.Inputs {
+		// Data is parsed as FP64 whatever the datatype says.
+		if t.Datatype != "FP64" {
+			return nil, status.Errorf(codes.InvalidArgument, "input %s has datatype %s, only FP64 is supported", t.Name, t.Datatype)
+		}
+		grpcReq.Inputs = append(grpcReq.Inputs, &inference.ModelInferRequest_InferInputTensor{
+			Name:     t.Name,
+			Datatype: t.Datatype,
+			Shape:    t.Shape,
+			Contents: &inference.InferTensorContents{Fp64Contents: t.Data},
+		})
+	}
+
+	res, err := s.ModelInfer(ctx, grpcReq)
+	if err != nil {
+		return nil, err
+	}
+	out := &restInferResponse{ModelName: res.ModelName, ModelVersion: res.ModelVersion, ID: res.Id}
+	for _, o := range res.Outputs {
+		out.Outputs = append(out.Outputs, restTensor{Name: o.Name, Shape: o.Shape, Datatype: o.Datatype, Data: o.Contents.Fp64Contents})
+	}
+	return out, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestLocalServer(t *testing.T) *localServer {
+	path := filepath.Join(t.TempDir(), "coefficients.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"intercept": 1, "coefficients": [2, -1]}`), 0644))
+
+	specs := modelFlags{}
+	for _, m := range []string{"lin=linear:" + path, "log=logistic:" + path, "echo=identity", "half=constant:0.5"} {
+		require.NoError(t, specs.Set(m))
+	}
+	s := newLocalServer(specs)
+	require.NoError(t, s.load())
+	return s
+}
+
+func TestNewLocalModel(t *testing.T) {
+	_, err := newLocalModel("m", "forest")
+	assert.Error(t, err)
+	_, err = newLocalModel("m", "constant:x")
+	assert.Error(t, err)
+	_, err = newLocalModel("m", "linear:missing.json")
+	assert.Error(t, err)
+
+	assert.Error(t, modelFlags{}.Set("linear"))
+}
+
+func TestLocalServerGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := grpc.NewServer()
+	inference.RegisterGRPCInferenceServiceServer(s, newTestLocalServer(t))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	client := NewKFServingGrpcClient(1, grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(time.Second))
+	defer client.Close()
+	host := lis.Addr().String()
+	ctx := context.Background()
+
+	infer := func(model string, tensor ...float64) ([]float64, error) {
+		res, err := client.Inference(ctx, host, &inference.ModelInferRequest{
+			ModelName: model,
+			Inputs: []*inference.ModelInferRequest_InferInputTensor{{
+				Datatype: "FP64",
+				Shape:    []int64{int64(len(tensor) / 2), 2},
+				Contents: &inference.InferTensorContents{Fp64Contents: tensor},
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.Outputs[0].Contents.Fp64Contents, nil
+	}
+
+	scores, err := infer("lin", 1, 1, 3, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2, 5}, scores)
+
+	scores, err = infer("log", 0, 1)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, scores[0], 1e-9)
+
+	scores, err = infer("echo", 1, 2, 3, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 3, 4}, scores)
+
+	scores, err = infer("half", 7, 8)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.5}, scores)
+
+	m, err := client.ModelMetadata(ctx, host, "lin", "")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{-1, 2}, m.Inputs[0].Shape)
+
+	require.NoError(t, client.RepositoryModelUnload(ctx, host, "", "lin"))
+	ready, err := client.ModelReady(ctx, host, "lin", "")
+	require.NoError(t, err)
+	assert.False(t, ready)
+	_, err = infer("lin", 1, 1)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	serverReady, err := client.ServerReady(ctx, host)
+	require.NoError(t, err)
+	assert.False(t, serverReady, "not ready while a model is unloaded")
+
+	index, err := client.RepositoryIndex(ctx, host, "", true)
+	require.NoError(t, err)
+	assert.Len(t, index, 3)
+
+	index, err = client.RepositoryIndex(ctx, host, "", false)
+	require.NoError(t, err)
+	require.Len(t, index, 4)
+	assert.Equal(t, &inference.RepositoryIndexResponse_ModelIndex{Name: "lin", Version: "1", State: "UNAVAILABLE", Reason: "unloaded"}, index[2])
+
+	require.NoError(t, client.RepositoryModelLoad(ctx, host, "", "lin"))
+	_, err = infer("lin", 1, 1)
+	assert.NoError(t, err)
+	serverReady, err = client.ServerReady(ctx, host)
+	require.NoError(t, err)
+	assert.True(t, serverReady)
+}
+
+func TestLocalServerRejectsBadShapes(t *testing.T) {
+	s := newTestLocalServer(t)
+	for _, c := range []struct {
+		shape  []int64
+		values []float64
+	}{
+		{[]int64{1 << 62, 4}, nil},
+		{[]int64{-2, -2}, []float64{1, 2, 3, 4}},
+		{[]int64{1 << 62, 0}, nil},
+		{[]int64{3, 1}, []float64{1, 2, 3, 4}},
+	} {
+		_, err := s.ModelInfer(context.Background(), &inference.ModelInferRequest{
+			ModelName: "echo",
+			Inputs: []*inference.ModelInferRequest_InferInputTensor{{
+				Datatype: "FP64",
+				Shape:    c.shape,
+				Contents: &inference.InferTensorContents{Fp64Contents: c.values},
+			}},
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", c.shape)
+	}
+}
+
+func TestLocalServerREST(t *testing.T) {
+	server := httptest.NewServer(restHandler(newTestLocalServer(t)))
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/v2/models/lin/versions/1/infer", "application/json",
+		strings.NewReader(`{"inputs": [{"name": "input-0", "shape": [2, 2], "datatype": "FP64", "data": [[1, 1], [3, 2]]}]}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var out restInferResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&out))
+	assert.Equal(t, "lin", out.ModelName)
+	assert.Equal(t, []float64{2, 5}, out.Outputs[0].Data)
+
+	res, err = http.Post(server.URL+"/v2/models/lin/infer", "application/json",
+		strings.NewReader(`{"inputs": [{"name": "input-0", "shape": [1, 2], "datatype": "INT64", "data": [1, 1]}]}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get(server.URL + "/v2/health/ready")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(server.URL + "/v2/models/missing/ready")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Post(server.URL+"/v2/repository/models/half/unload", "application/json", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(server.URL + "/v2/models/half/ready")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	res, err = http.Get(server.URL + "/v2/health/ready")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, "not ready while a model is unloaded")
+
+	res, err = http.Get(server.URL + "/v2/models/echo")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	var m modelMetadataJSON
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&m))
+	assert.Equal(t, "identity", m.Platform)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/status"
+)
+
+// shadowTarget is the candidate model every chunk is also sent to when
+// comparing it with the primary model.
+type shadowTarget struct {
+	model   string
+	version string
+	lb      *balancer
+}
+
+// candidate is nil unless a candidate model is set.
+var candidate *shadowTarget
+
+// inferChunk sends req to the primary model and, when comparing, the same rows
+// to the candidate in parallel, returning the candidate scores. A chunk fails
+// only if the primary call fails; when the candidate fails, its scores are
+// nil. The latency is that of the primary call.
+func inferChunk(ctx context.Context, r *RequestChunk, req *inference.ModelInferRequest) (*inference.ModelInferResponse, []float64, time.Duration, error) {
+	if candidate == nil {
+		res, latency, err := inferWithRetry(ctx, lb, req)
+		return res, nil, latency, err
+	}
+
+	var (
+		candidateRes *inference.ModelInferResponse
+		candidateErr error
+		done         = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		candidateRes, candidateErr = inferCandidate(ctx, newModelInferRequest(r, candidate.model, candidate.version))
+	}()
+	res, latency, err := inferWithRetry(ctx, lb, req)
+	<-done
+
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var candidateScores []float64
+	if candidateErr == nil {
+		candidateScores, candidateErr = scores(candidateRes, r.RecordCount)
+	}
+	if candidateErr != nil {
+		loggerFrom(ctx).WithField("rows", r.RecordCount).WithError(candidateErr).Warn("candidate ModelInfer failed, keep the primary scores")
+		shadowScores.failed(r.RecordCount)
+		return res, nil, latency, nil
+	}
+	return res, candidateScores, latency, nil
+}
+
+// inferCandidate calls ModelInfer on the candidate, retrying like
+// inferWithRetry. Its latency is kept apart and it bypasses the concurrency
+// limit, so that the primary model's metrics and batch sizing are the same as
+// without a candidate. When the candidate is on the primary's hosts, its calls
+// share the rate limits, which protect those hosts.
+func inferCandidate(ctx context.Context, r *inference.ModelInferRequest) (*inference.ModelInferResponse, error) {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		if candidate.lb == lb {
+			if err := limiter.Wait(ctx, requestRows(r)); err != nil {
+				return nil, err
+			}
+		}
+
+		actx, span := tracer.Start(ctx, "candidate ModelInfer", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+		start := time.Now()
+		res, err := candidate.lb.Inference(injectTraceContext(actx), r)
+		shadowScores.latency(time.Since(start))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, status.Code(err).String())
+		}
+		span.End()
+
+		if err == nil || attempt >= maxRetries || !retryable(err) {
+			return res, err
+		}
+
+		loggerFrom(ctx).WithFields(logrus.Fields{"attempt": attempt + 1, "backoff": backoff.String()}).WithError(err).Info("retry candidate ModelInfer")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// comparison collects the primary and candidate score of every row. All of
+// them are kept to compute rank agreement, 16 bytes per row.
+type comparison struct {
+	mutex      sync.Mutex
+	primary    []float64
+	candidate  []float64
+	latencies  *latencyReservoir
+	failedRows int64
+}
+
+func newComparison() *comparison {
+	return &comparison{latencies: newLatencyReservoir()}
+}
+
+var shadowScores = newComparison()
+
+func (c *comparison) add(primary, candidate float64) {
+	c.mutex.Lock()
+	c.primary = append(c.primary, primary)
+	c.candidate = append(c.candidate, candidate)
+	c.mutex.Unlock()
+}
+
+// failed counts rows the candidate did not score.
+func (c *comparison) failed(rows int64) {
+	c.mutex.Lock()
+	c.failedRows += rows
+	c.mutex.Unlock()
+}
+
+func (c *comparison) latency(d time.Duration) {
+	c.mutex.Lock()
+	c.latencies.add(d)
+	c.mutex.Unlock()
+}
+
+type shadowSummary struct {
+	Requests        int            `json:"requests"`
+	Latency         latencySummary `json:"latency"`
+	Rows            int            `json:"rows"`
+	CandidateFailed int64          `json:"candidate_failed"`
+	MeanAbsDiff     float64        `json:"mean_abs_diff"`
+	P99AbsDiff      float64        `json:"p99_abs_diff"`
+	MaxAbsDiff      float64        `json:"max_abs_diff"`
+	MeanRelDiff     float64        `json:"mean_rel_diff"`
+	P99RelDiff      float64        `json:"p99_rel_diff"`
+	MaxRelDiff      float64        `json:"max_rel_diff"`
+	Correlation     float64        `json:"correlation"`
+	RankCorrelation float64        `json:"rank_correlation"`
+}
+
+// quantile returns the q quantile of sorted values, by nearest rank.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func mean(x []float64) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += v
+	}
+	return sum / float64(len(x))
+}
+
+// pearson returns the correlation of x and y, 1 when both are constant and
+// equal and 0 when only one of them is constant.
+func pearson(x, y []float64) float64 {
+	mx, my := mean(x), mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		if sxx == syy {
+			return 1
+		}
+		return 0
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+// ranks returns the rank of every value of x, ties sharing their average
+// rank.
+func ranks(x []float64) []float64 {
+	order := make([]int, len(x))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return x[order[i]] < x[order[j]] })
+
+	r := make([]float64, len(x))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && x[order[j+1]] == x[order[i]] {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			r[order[k]] = float64(i+j)/2 + 1
+		}
+		i = j + 1
+	}
+	return r
+}
+
+func (c *comparison) summary() shadowSummary {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := shadowSummary{Requests: c.latencies.requests, Latency: c.latencies.summary(), Rows: len(c.primary), CandidateFailed: c.failedRows}
+	if s.Rows == 0 {
+		return s
+	}
+
+	abs := make([]float64, s.Rows)
+	rel := make([]float64, s.Rows)
+	for i, p := range c.primary {
+		abs[i] = math.Abs(p - c.candidate[i])
+		if scale := math.Max(math.Abs(p), math.Abs(c.candidate[i])); scale > 0 {
+			rel[i] = abs[i] / scale
+		}
+	}
+	s.MeanAbsDiff, s.MeanRelDiff = mean(abs), mean(rel)
+	sort.Float64s(abs)
+	sort.Float64s(rel)
+	s.P99AbsDiff, s.MaxAbsDiff = quantile(abs, 0.99), abs[s.Rows-1]
+	s.P99RelDiff, s.MaxRelDiff = quantile(rel, 0.99), rel[s.Rows-1]
+
+	s.Correlation = pearson(c.primary, c.candidate)
+	s.RankCorrelation = pearson(ranks(c.primary), ranks(c.candidate))
+	return s
+}
+
+// shadowThresholds bound how far the candidate may diverge from the primary
+// model and how many rows it may fail to score, 0 disabling a bound.
+type shadowThresholds struct {
+	MaxMeanAbsDiff     float64
+	MaxP99RelDiff      float64
+	MinCorrelation     float64
+	MinRankCorrelation float64
+	MaxCandidateFailed float64
+}
+
+// check fails when a bound is exceeded, or when any is set but no row could
+// be compared.
+func (s shadowSummary) check(t shadowThresholds) error {
+	if t == (shadowThresholds{}) {
+		return nil
+	}
+	if s.Rows == 0 {
+		return fmt.Errorf("no rows compared with the candidate, it failed to score %d", s.CandidateFailed)
+	}
+
+	var violations []string
+	if failed := float64(s.CandidateFailed) / float64(int64(s.Rows)+s.CandidateFailed); t.MaxCandidateFailed > 0 && failed > t.MaxCandidateFailed {
+		violations = append(violations, fmt.Sprintf("candidate failed on %g of the rows, above %g", failed, t.MaxCandidateFailed))
+	}
+	if t.MaxMeanAbsDiff > 0 && s.MeanAbsDiff > t.MaxMeanAbsDiff {
+		violations = append(violations, fmt.Sprintf("mean absolute difference %g above %g", s.MeanAbsDiff, t.MaxMeanAbsDiff))
+	}
+	if t.MaxP99RelDiff > 0 && s.P99RelDiff > t.MaxP99RelDiff {
+		violations = append(violations, fmt.Sprintf("p99 relative difference %g above %g", s.P99RelDiff, t.MaxP99RelDiff))
+	}
+	if t.MinCorrelation > 0 && s.Correlation < t.MinCorrelation {
+		violations = append(violations, fmt.Sprintf("correlation %g below %g", s.Correlation, t.MinCorrelation))
+	}
+	if t.MinRankCorrelation > 0 && s.RankCorrelation < t.MinRankCorrelation {
+		violations = append(violations, fmt.Sprintf("rank correlation %g below %g", s.RankCorrelation, t.MinRankCorrelation))
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("candidate diverges from the primary model: %s", strings.Join(violations, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inferencetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+)
+
+func TestRanks(t *testing.T) {
+	assert.Equal(t, []float64{3, 1, 4.5, 2, 4.5}, ranks([]float64{0.3, 0.1, 0.7, 0.2, 0.7}))
+}
+
+func TestPearson(t *testing.T) {
+	assert.InDelta(t, 1, pearson([]float64{1, 2, 3}, []float64{2, 4, 6}), 1e-9)
+	assert.InDelta(t, -1, pearson([]float64{1, 2, 3}, []float64{3, 2, 1}), 1e-9)
+	assert.Equal(t, float64(1), pearson([]float64{1, 1}, []float64{5, 5}))
+	assert.Equal(t, float64(0), pearson([]float64{1, 2}, []float64{5, 5}))
+}
+
+func TestComparisonSummary(t *testing.T) {
+	c := newComparison()
+	assert.Equal(t, 0, c.summary().Rows)
+
+	c.add(1, 1)
+	c.add(2, 3)
+	c.add(4, 3)
+	c.add(0, 0)
+
+	s := c.summary()
+	assert.Equal(t, 4, s.Rows)
+	assert.InDelta(t, 0.5, s.MeanAbsDiff, 1e-9)
+	assert.Equal(t, float64(1), s.MaxAbsDiff)
+	assert.InDelta(t, 1.0/3, s.MaxRelDiff, 1e-9)
+	assert.InDelta(t, 0.9486832980505138, s.RankCorrelation, 1e-9)
+
+	assert.NoError(t, s.check(shadowThresholds{MaxMeanAbsDiff: 1, MinRankCorrelation: 0.9}))
+	err := s.check(shadowThresholds{MaxMeanAbsDiff: 0.1, MinCorrelation: 0.99})
+	assert.EqualError(t, err, "candidate diverges from the primary model: mean absolute difference 0.5 above 0.1, correlation 0.8783100656536799 below 0.99")
+
+	c.failed(4)
+	s = c.summary()
+	assert.NoError(t, s.check(shadowThresholds{MaxCandidateFailed: 0.5}))
+	assert.EqualError(t, s.check(shadowThresholds{MaxCandidateFailed: 0.25}), "candidate diverges from the primary model: candidate failed on 0.5 of the rows, above 0.25")
+}
+
+func TestShadowCheckNoRowsCompared(t *testing.T) {
+	c := newComparison()
+	c.failed(10)
+	s := c.summary()
+
+	assert.NoError(t, s.check(shadowThresholds{}), "no bound, nothing to check")
+	assert.EqualError(t, s.check(shadowThresholds{MaxMeanAbsDiff: 0.1}), "no rows compared with the candidate, it failed to score 10")
+}
+
+func TestInferCandidateRateLimits(t *testing.T) {
+	s := inferencetest.NewServer(nil)
+	require.NoError(t, s.Start())
+	defer s.Stop()
+
+	client := NewKFServingGrpcClient(1, append(s.DialOptions(), grpc.WithBlock(), grpc.WithTimeout(time.Second))...)
+	defer client.Close()
+
+	oldLB, oldLimiter, oldCandidate := lb, limiter, candidate
+	defer func() { lb, limiter, candidate = oldLB, oldLimiter, oldCandidate }()
+	lb = newBalancer(client, []string{s.Addr})
+	limiter = newThrottle(0, 1, 4)
+
+	chunk := NewRequestChunk()
+	for i := 0; i < 4; i++ {
+		chunk.AddRecord(request{EntityKey: "e", Tensor: []float64{1}})
+	}
+	req := newModelInferRequest(chunk, "model", "")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	candidate = &shadowTarget{model: "model", lb: lb}
+	_, err := inferCandidate(ctx, req)
+	require.NoError(t, err)
+	_, err = inferCandidate(ctx, req)
+	assert.Error(t, err, "on the primary's hosts, the next 4 rows would take 4s")
+
+	candidate.lb = newBalancer(client, []string{s.Addr})
+	_, err = inferCandidate(ctx, req)
+	assert.NoError(t, err, "other hosts are not throttled")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"kfserving-inference-client/inference"
+)
+
+type statDuration struct {
+	Count uint64
+	Ns    uint64
+}
+
+func (d *statDuration) add(s *inference.StatisticDuration) {
+	d.Count += s.GetCount()
+	d.Ns += s.GetNs()
+}
+
+func sub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+func (d statDuration) sub(o statDuration) statDuration {
+	return statDuration{Count: sub(d.Count, o.Count), Ns: sub(d.Ns, o.Ns)}
+}
+
+type batchStat struct {
+	ComputeInput, ComputeInfer, ComputeOutput statDuration
+}
+
+// serverStats sums ModelStatistics over every endpoint serving the model so
+// that snapshots taken before and after a run can be diffed.
+type serverStats struct {
+	InferenceCount uint64
+	ExecutionCount uint64
+
+	Success, Fail, Queue                      statDuration
+	ComputeInput, ComputeInfer, ComputeOutput statDuration
+
+	Batches map[uint64]*batchStat
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{Batches: make(map[uint64]*batchStat)}
+}
+
+func (s *serverStats) add(m *inference.ModelStatistics) {
+	s.InferenceCount += m.GetInferenceCount()
+	s.ExecutionCount += m.GetExecutionCount()
+
+	is := m.GetInferenceStats()
+	s.Success.add(is.GetSuccess())
+	s.Fail.add(is.GetFail())
+	s.Queue.add(is.GetQueue())
+	s.ComputeInput.add(is.GetComputeInput())
+	s.ComputeInfer.add(is.GetComputeInfer())
+	s.ComputeOutput.add(is.GetComputeOutput())
+
+	for _, bs := range m.GetBatchStats() {
+		b, ok := s.Batches[bs.GetBatchSize()]
+		if !ok {
+			b = &batchStat{}
+			s.Batches[bs.GetBatchSize()] = b
+		}
+		b.ComputeInput.add(bs.GetComputeInput())
+		b.ComputeInfer.add(bs.GetComputeInfer())
+		b.ComputeOutput.add(bs.GetComputeOutput())
+	}
+}
+
+// sub returns s - o. Counters that went backwards, e.g. because a replica
+// restarted, are reported as zero.
+func (s *serverStats) sub(o *serverStats) *serverStats {
+	d := &serverStats{
+		InferenceCount: sub(s.InferenceCount, o.InferenceCount),
+		ExecutionCount: sub(s.ExecutionCount, o.ExecutionCount),
+		Success:        s.Success.sub(o.Success),
+		Fail:           s.Fail.sub(o.Fail),
+		Queue:          s.Queue.sub(o.Queue),
+		ComputeInput:   s.ComputeInput.sub(o.ComputeInput),
+		ComputeInfer:   s.ComputeInfer.sub(o.ComputeInfer),
+		ComputeOutput:  s.ComputeOutput.sub(o.ComputeOutput),
+		Batches:        make(map[uint64]*batchStat),
+	}
+	for size, b := range s.Batches {
+		before, ok := o.Batches[size]
+		if !ok {
+			before = &batchStat{}
+		}
+		delta := &batchStat{
+			ComputeInput:  b.ComputeInput.sub(before.ComputeInput),
+			ComputeInfer:  b.ComputeInfer.sub(before.ComputeInfer),
+			ComputeOutput: b.ComputeOutput.sub(before.ComputeOutput),
+		}
+		if delta.ComputeInfer.Count > 0 {
+			d.Batches[size] = delta
+		}
+	}
+	return d
+}
+
+// snapshotStats sums the statistics of model on every host. It returns nil
+// if any host does not support the ModelStatistics RPC.
+func snapshotStats(ctx context.Context, client *KFServingGrpcClient, hosts []string, model, version string) *serverStats {
+	s := newServerStats()
+	for _, h := range hosts {
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		res, err := client.ModelStatistics(cctx, h, model, version)
+		cancel()
+		if err != nil {
+			logger.WithField("host", h).WithError(err).Warn("ModelStatistics unavailable, server statistics are left out of the report")
+			return nil
+		}
+		for _, m := range res.GetModelStats() {
+			s.add(m)
+		}
+	}
+	return s
+}
+
+type durationJSON struct {
+	Count   uint64  `json:"count"`
+	TotalMs float64 `json:"total_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+}
+
+func (d statDuration) JSON() durationJSON {
+	j := durationJSON{Count: d.Count, TotalMs: float64(d.Ns) / float64(time.Millisecond)}
+	if d.Count > 0 {
+		j.AvgMs = j.TotalMs / float64(d.Count)
+	}
+	return j
+}
+
+type batchStatJSON struct {
+	BatchSize     uint64       `json:"batch_size"`
+	Executions    uint64       `json:"executions"`
+	ComputeInput  durationJSON `json:"compute_input"`
+	ComputeInfer  durationJSON `json:"compute_infer"`
+	ComputeOutput durationJSON `json:"compute_output"`
+}
+
+type serverStatsJSON struct {
+	InferenceCount uint64          `json:"inference_count"`
+	ExecutionCount uint64          `json:"execution_count"`
+	Success        durationJSON    `json:"success"`
+	Fail           durationJSON    `json:"fail"`
+	Queue          durationJSON    `json:"queue"`
+	ComputeInput   durationJSON    `json:"compute_input"`
+	ComputeInfer   durationJSON    `json:"compute_infer"`
+	ComputeOutput  durationJSON    `json:"compute_output"`
+	Batches        []batchStatJSON `json:"batches"`
+}
+
+func (s *serverStats) JSON() *serverStatsJSON {
+	j := &serverStatsJSON{
+		InferenceCount: s.InferenceCount,
+		ExecutionCount: s.ExecutionCount,
+		Success:        s.Success.JSON(),
+		Fail:           s.Fail.JSON(),
+		Queue:          s.Queue.JSON(),
+		ComputeInput:   s.ComputeInput.JSON(),
+		ComputeInfer:   s.ComputeInfer.JSON(),
+		ComputeOutput:  s.ComputeOutput.JSON(),
+	}
+	for size, b := range s.Batches {
+		j.Batches = append(j.Batches, batchStatJSON{
+			BatchSize:     size,
+			Executions:    b.ComputeInfer.Count,
+			ComputeInput:  b.ComputeInput.JSON(),
+			ComputeInfer:  b.ComputeInfer.JSON(),
+			ComputeOutput: b.ComputeOutput.JSON(),
+		})
+	}
+	sort.Slice(j.Batches, func(a, b int) bool { return j.Batches[a].BatchSize < j.Batches[b].BatchSize })
+	return j
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func modelStats(count, ns uint64) *inference.ModelStatistics {
+	d := func(c, n uint64) *inference.StatisticDuration { return &inference.StatisticDuration{Count: c, Ns: n} }
+	return &inference.ModelStatistics{
+		InferenceCount: count * 10,
+		ExecutionCount: count,
+		InferenceStats: &inference.InferStatistics{
+			Success:      d(count, ns),
+			Queue:        d(count, ns/10),
+			ComputeInfer: d(count, ns/2),
+		},
+		BatchStats: []*inference.InferBatchStatistics{
+			{BatchSize: 10, ComputeInfer: d(count, ns/2)},
+		},
+	}
+}
+
+func TestServerStatsDelta(t *testing.T) {
+	before := newServerStats()
+	before.add(modelStats(2, 2e6))
+
+	after := newServerStats()
+	after.add(modelStats(3, 3e6))
+	after.add(modelStats(4, 4e6))
+
+	j := after.sub(before).JSON()
+	assert.Equal(t, uint64(50), j.InferenceCount)
+	assert.Equal(t, uint64(5), j.ExecutionCount)
+	assert.Equal(t, durationJSON{Count: 5, TotalMs: 5, AvgMs: 1}, j.Success)
+	assert.Equal(t, durationJSON{Count: 5, TotalMs: 0.5, AvgMs: 0.1}, j.Queue)
+	assert.Equal(t, []batchStatJSON{{
+		BatchSize:    10,
+		Executions:   5,
+		ComputeInfer: durationJSON{Count: 5, TotalMs: 2.5, AvgMs: 0.5},
+	}}, j.Batches)
+
+	restarted := newServerStats()
+	restarted.add(modelStats(1, 1e6))
+	assert.Equal(t, uint64(0), restarted.sub(before).ExecutionCount)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kfserving-inference-client/inference"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type liveServer struct {
+	inference.UnimplementedGRPCInferenceServiceServer
+}
+
+func (*liveServer) ServerLive(context.Context, *inference.ServerLiveRequest) (*inference.ServerLiveResponse, error) {
+	return &inference.ServerLiveResponse{Live: true}, nil
+}
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if !isCA {
+		template.DNSNames = []string{cn}
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+// startTLSServer serves liveServer on a local port and returns its address.
+// Client certificates signed by ca are required when mutual is set.
+func startTLSServer(t *testing.T, ca, server *testCert, mutual bool) string {
+	pair, err := tls.X509KeyPair(server.certPEM, server.keyPEM)
+	require.NoError(t, err)
+
+	config := &tls.Config{Certificates: []tls.Certificate{pair}}
+	if mutual {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(config)))
+	inference.RegisterGRPCInferenceServiceServer(s, &liveServer{})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return lis.Addr().String()
+}
+
+func serverLive(t *testing.T, host string, o TLSOptions) error {
+	transport, err := o.DialOption()
+	require.NoError(t, err)
+
+	client := NewKFServingGrpcClient(1, transport, grpc.WithBlock(), grpc.WithTimeout(2*time.Second))
+	defer client.Close()
+
+	_, err = client.ServerLive(context.Background(), host)
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	server := newTestCert(t, "model.example.com", ca, false)
+	client := newTestCert(t, "batch-client", ca, false)
+
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM)
+	certFile := writeFile(t, dir, "client.pem", client.certPEM)
+	keyFile := writeFile(t, dir, "client-key.pem", client.keyPEM)
+
+	host := startTLSServer(t, ca, server, false)
+
+	assert.NoError(t, serverLive(t, host, TLSOptions{CAFile: caFile, ServerName: "model.example.com"}))
+	assert.NoError(t, serverLive(t, host, TLSOptions{InsecureSkipVerify: true}))
+	assert.Error(t, serverLive(t, host, TLSOptions{CAFile: caFile, ServerName: "other.example.com"}))
+	assert.Error(t, serverLive(t, host, TLSOptions{}))
+
+	mtlsHost := startTLSServer(t, ca, server, true)
+
+	assert.NoError(t, serverLive(t, mtlsHost, TLSOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "model.example.com"}))
+	assert.Error(t, serverLive(t, mtlsHost, TLSOptions{CAFile: caFile, ServerName: "model.example.com"}))
+}
+
+func TestTLSResolvedAddress(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil, true)
+	server := newTestCert(t, "model.example.com", ca, false)
+	caFile := writeFile(t, dir, "ca.pem", ca.certPEM)
+
+	// The server listens on the address model.example.com resolves to.
+	addr := startTLSServer(t, ca, server, false)
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	addrs, authorities, err := resolveEndpoints("model.example.com:"+port, func(string) ([]string, error) {
+		return []string{"127.0.0.1", "127.0.0.1"}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, addr, addrs[0])
+
+	transport, err := TLSOptions{CAFile: caFile}.DialOption()
+	require.NoError(t, err)
+	client := NewKFServingGrpcClient(1, transport, grpc.WithBlock(), grpc.WithTimeout(2*time.Second))
+	defer client.Close()
+
+	client.tls = TLSOptions{CAFile: caFile}
+	client.setAuthorities(authorities)
+	_, err = client.ServerLive(context.Background(), addrs[0])
+	assert.NoError(t, err, "verifies the certificate against the resolved name")
+
+	assert.Error(t, serverLive(t, addr, TLSOptions{CAFile: caFile}), "fails against the bare address")
+}
+
+func TestTLSOptionsConfig(t *testing.T) {
+	_, err := TLSOptions{CertFile: "client.pem"}.Config()
+	assert.Error(t, err)
+
+	_, err = TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}.Config()
+	assert.Error(t, err)
+}
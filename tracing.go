@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"google.golang.org/grpc/metadata"
+)
+
+const tracerName = "kfserving-inference-client"
+
+var tracer = otel.Tracer(tracerName)
+
+// initTracing installs the global tracer provider for the given exporter,
+// "otlp" or "file". It returns a function flushing pending spans.
+func initTracing(ctx context.Context, exporter, otlpEndpoint, traceFile string) (func(context.Context) error, error) {
+	var (
+		spanExporter sdktrace.SpanExporter
+		closeFile    = func() error { return nil }
+		err          error
+	)
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		options := []otlptracegrpc.Option{otlptracegrpc.WithInsecure()}
+		if otlpEndpoint != "" {
+			options = append(options, otlptracegrpc.WithEndpoint(otlpEndpoint))
+		}
+		spanExporter, err = otlptracegrpc.New(ctx, options...)
+	case "file":
+		var file *os.File
+		if file, err = os.Create(traceFile); err != nil {
+			return nil, err
+		}
+		closeFile = file.Close
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return func(ctx context.Context) error {
+		if err := provider.Shutdown(ctx); err != nil {
+			return err
+		}
+		return closeFile()
+	}, nil
+}
+
+// metadataCarrier adapts outgoing gRPC metadata to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// injectTraceContext adds the W3C trace context of the span in ctx to the
+// outgoing gRPC metadata.
+func injectTraceContext(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
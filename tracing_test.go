@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInjectTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "a")
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(ctx, "chunk")
+	defer span.End()
+
+	md, ok := metadata.FromOutgoingContext(injectTraceContext(ctx))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"a"}, md.Get("x-tenant"))
+
+	traceparent := md.Get("traceparent")
+	if assert.Len(t, traceparent, 1) {
+		assert.Contains(t, traceparent[0], span.SpanContext().TraceID().String())
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"kfserving-inference-client/inference"
+	"kfserving-inference-client/mapping"
+
+	"github.com/spf13/cast"
+)
+
+func init() {
+	var (
+		input    string
+		format   string
+		examples int
+		timeout  time.Duration
+	)
+	commands = append(commands, &command{
+		name:    "validate",
+		summary: "Check an input file for malformed rows and model compatibility without scoring it",
+		flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&input, "i", "", "The input file to check")
+			fs.StringVar(&mappingPath, "mapping_path", ".", "The feature mapping csv file path")
+			fs.StringVar(&format, "format", "table", "Output format: table or json")
+			fs.IntVar(&examples, "examples", 5, "How many example rows to print for each kind of issue")
+			fs.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of the ModelMetadata call")
+		},
+		run: func([]string) error {
+			return runValidate(input, format, examples, timeout)
+		},
+	})
+}
+
+// Kinds of input issues.
+const (
+	issueColumnCount     = "column_count"
+	issueNonNumeric      = "non_numeric"
+	issueUnknownCategory = "unknown_category"
+	issueNaNInf          = "nan_inf"
+	issueDuplicateKey    = "duplicate_key"
+	issueModel           = "model"
+)
+
+var errInvalid = errors.New("input is invalid")
+
+type inputIssue struct {
+	Kind   string `json:"kind"`
+	Row    int64  `json:"row,omitempty"`
+	Column string `json:"column,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type validationReport struct {
+	Rows     int64            `json:"rows"`
+	Features int              `json:"features"`
+	Issues   map[string]int64 `json:"issues"`
+	Examples []inputIssue     `json:"examples"`
+
+	examples int
+}
+
+func (v *validationReport) add(issue inputIssue) {
+	v.Issues[issue.Kind]++
+	if v.Issues[issue.Kind] <= int64(v.examples) {
+		v.Examples = append(v.Examples, issue)
+	}
+}
+
+func (v *validationReport) valid() bool {
+	return len(v.Issues) == 0
+}
+
+// validateInput reads the input file like getRequestFromFile, but reports
+// what would go wrong during scoring instead of failing on it. Rows are
+// numbered from 1, not counting the header.
+func validateInput(r io.Reader, examples int) (*validationReport, error) {
+	v := &validationReport{Issues: make(map[string]int64), examples: examples}
+
+	csvr := csv.NewReader(r)
+	csvr.FieldsPerRecord = -1
+
+	head, err := csvr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read input header: %w", err)
+	}
+	v.Features = len(head) - 1
+
+	var (
+		categories = mapping.GetMapping()
+		keys       = make(map[string]int64)
+	)
+	for {
+		row, err := csvr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("read input row %d: %w", v.Rows+1, err)
+		}
+		v.Rows++
+
+		if len(row) != len(head) {
+			v.add(inputIssue{Kind: issueColumnCount, Row: v.Rows, Value: fmt.Sprintf("%d columns, header has %d", len(row), len(head))})
+			continue
+		}
+
+		if first, ok := keys[row[0]]; ok {
+			v.add(inputIssue{Kind: issueDuplicateKey, Row: v.Rows, Column: head[0], Value: fmt.Sprintf("%s, first in row %d", row[0], first)})
+		} else {
+			keys[row[0]] = v.Rows
+		}
+
+		for i, value := range row[1:] {
+			name := head[i+1]
+			if values, ok := categories[name]; ok {
+				if _, ok := values[value]; !ok {
+					v.add(inputIssue{Kind: issueUnknownCategory, Row: v.Rows, Column: name, Value: value})
+				}
+			} else if _, err := cast.ToFloat64E(value); err != nil {
+				v.add(inputIssue{Kind: issueNonNumeric, Row: v.Rows, Column: name, Value: value})
+			}
+		}
+
+		for i, f := range mapRow(head, row).Tensor {
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				v.add(inputIssue{Kind: issueNaNInf, Row: v.Rows, Column: head[i+1], Value: row[i+1]})
+			}
+		}
+	}
+	return v, nil
+}
+
+// validateModelMetadata checks that the model takes the single FP64
+// [batch, features] tensor the client sends.
+func validateModelMetadata(m *inference.ModelMetadataResponse, features int) error {
+	if len(m.Inputs) != 1 {
+		return fmt.Errorf("model %s expects %d inputs, the client sends exactly one", m.Name, len(m.Inputs))
+	}
+
+	input := m.Inputs[0]
+	if input.Datatype != "FP64" {
+		return fmt.Errorf("input %s has datatype %s, the client sends FP64", input.Name, input.Datatype)
+	}
+	if n := len(input.Shape); n > 0 && !dimMatches(input.Shape[n-1], int64(features)) {
+		return fmt.Errorf("input %s has shape %v, the input file has %d features", input.Name, input.Shape, features)
+	}
+	return nil
+}
+
+func runValidate(input, format string, examples int, timeout time.Duration) error {
+	if input == "" {
+		return fmt.Errorf("missing input file, set -i")
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mapping.Init(mappingPath)
+	v, err := validateInput(file, examples)
+	if err != nil {
+		return err
+	}
+
+	// The model is only checked when there is one to ask.
+	if host != "" && modelName != "" {
+		addrs, err := connect()
+		if err != nil {
+			return err
+		}
+		defer kfServingGrpcClient.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		m, err := kfServingGrpcClient.ModelMetadata(ctx, addrs[0], modelName, modelVersion)
+		if err == nil {
+			err = validateModelMetadata(m, v.Features)
+		}
+		if err != nil {
+			v.add(inputIssue{Kind: issueModel, Value: err.Error()})
+		}
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+	case "table":
+		if err := printValidation(os.Stdout, v); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	if !v.valid() {
+		return errInvalid
+	}
+	return nil
+}
+
+func printValidation(out io.Writer, v *validationReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Rows:\t%d\n", v.Rows)
+	fmt.Fprintf(w, "Features:\t%d\n", v.Features)
+	if v.valid() {
+		fmt.Fprintln(w, "No issues found")
+		return w.Flush()
+	}
+
+	kinds := make([]string, 0, len(v.Issues))
+	for k := range v.Issues {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	fmt.Fprintln(w, "\nISSUE\tCOUNT")
+	for _, k := range kinds {
+		fmt.Fprintf(w, "%s\t%d\n", k, v.Issues[k])
+	}
+
+	fmt.Fprintln(w, "\nISSUE\tROW\tCOLUMN\tVALUE")
+	for _, e := range v.Examples {
+		row := "-"
+		if e.Row > 0 {
+			row = fmt.Sprint(e.Row)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%q\n", e.Kind, row, e.Column, e.Value)
+	}
+	return w.Flush()
+}
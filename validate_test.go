@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kfserving-inference-client/inference"
+	"kfserving-inference-client/mapping"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInput(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "city.csv"), []byte("value,mapping\nbeijing,1\nshanghai,2\n"), 0644))
+	mapping.Init(dir)
+
+	input := strings.Join([]string{
+		"entity_key,city,age,score",
+		"1,beijing,31,0.5",
+		"2,paris,42,0.1",
+		"3,shanghai,n/a,",
+		"1,beijing,31,NaN",
+		"4,beijing,31",
+		"5,shanghai,+Inf,1e3",
+	}, "\n")
+
+	v, err := validateInput(strings.NewReader(input), 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), v.Rows)
+	assert.Equal(t, 3, v.Features)
+	assert.Equal(t, map[string]int64{
+		issueUnknownCategory: 1,
+		issueNonNumeric:      2,
+		issueDuplicateKey:    1,
+		issueNaNInf:          2,
+		issueColumnCount:     1,
+	}, v.Issues)
+	assert.Len(t, v.Examples, 5, "one example per kind")
+	assert.Contains(t, v.Examples, inputIssue{Kind: issueUnknownCategory, Row: 2, Column: "city", Value: "paris"})
+	assert.Contains(t, v.Examples, inputIssue{Kind: issueNonNumeric, Row: 3, Column: "age", Value: "n/a"})
+
+	var out bytes.Buffer
+	require.NoError(t, printValidation(&out, v))
+	assert.Contains(t, out.String(), "nan_inf           2\n")
+	assert.Contains(t, out.String(), "column_count      5                \"3 columns, header has 4\"")
+
+	v, err = validateInput(strings.NewReader("entity_key,age\n1,31\n2,42\n"), 1)
+	require.NoError(t, err)
+	assert.True(t, v.valid())
+}
+
+func TestValidateModelMetadata(t *testing.T) {
+	m := &inference.ModelMetadataResponse{
+		Name:   "simple",
+		Inputs: []*inference.ModelMetadataResponse_TensorMetadata{{Name: "input-0", Datatype: "FP64", Shape: []int64{-1, 3}}},
+	}
+	assert.NoError(t, validateModelMetadata(m, 3))
+	assert.Error(t, validateModelMetadata(m, 4))
+
+	m.Inputs[0].Shape = []int64{-1, -1}
+	assert.NoError(t, validateModelMetadata(m, 4))
+
+	m.Inputs[0].Datatype = "FP32"
+	assert.Error(t, validateModelMetadata(m, 4))
+}